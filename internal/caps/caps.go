@@ -0,0 +1,128 @@
+// Package caps drops a process's Linux capability sets down to nothing but
+// an operator-approved allowlist. It's meant to run in the stage2 child
+// right before it execve's the sandboxed command, since capabilities are a
+// per-process property that can't be narrowed on an already-running child
+// from outside.
+package caps
+
+import (
+  "errors"
+  "fmt"
+  "os"
+  "strconv"
+  "strings"
+
+  "golang.org/x/sys/unix"
+)
+
+// allowedCaps is the full set of capabilities --cap-add may restore. It's
+// kept small and explicit: landlock/seccomp already cover most of what a
+// workspace command needs, so anything not listed here has to go through a
+// review before it's addable.
+var allowedCaps = map[string]uintptr{
+  "CAP_NET_BIND_SERVICE": unix.CAP_NET_BIND_SERVICE,
+  "CAP_CHOWN":            unix.CAP_CHOWN,
+}
+
+// Parse validates a comma-separated --cap-add value against allowedCaps.
+func Parse(raw string) ([]uintptr, error) {
+  if raw == "" {
+    return nil, nil
+  }
+  var keep []uintptr
+  for _, name := range strings.Split(raw, ",") {
+    name = strings.TrimSpace(name)
+    if name == "" {
+      continue
+    }
+    cap, ok := allowedCaps[name]
+    if !ok {
+      return nil, fmt.Errorf("caps: disallowed capability %q", name)
+    }
+    keep = append(keep, cap)
+  }
+  return keep, nil
+}
+
+// DropAll sets PR_SET_NO_NEW_PRIVS, drops every bounding-set capability not
+// in keep via PR_CAPBSET_DROP, and narrows the permitted/effective/
+// inheritable sets down to keep plus CAP_SETUID/CAP_SETGID. Those two stay
+// in place because stage2 still has to switch from root to the workspace's
+// uid/gid (via unix.Setresuid/Setresgid) after this runs; call
+// FinishDropAll once that switch is done to drop them for good.
+func DropAll(keep []uintptr) error {
+  if err := unix.Prctl(unix.PR_SET_NO_NEW_PRIVS, 1, 0, 0, 0); err != nil {
+    return fmt.Errorf("caps: set no_new_privs: %w", err)
+  }
+
+  last, err := lastCap()
+  if err != nil {
+    return err
+  }
+  keepSet := make(map[uintptr]struct{}, len(keep))
+  for _, c := range keep {
+    keepSet[c] = struct{}{}
+  }
+
+  for c := uintptr(0); c <= last; c++ {
+    if _, ok := keepSet[c]; ok {
+      continue
+    }
+    if err := unix.Prctl(unix.PR_CAPBSET_DROP, c, 0, 0, 0); err != nil {
+      if errors.Is(err, unix.EPERM) {
+        // No CAP_SETPCAP left to drop with, so there's nothing more this
+        // loop can do; treat it as already satisfied rather than failing
+        // the invocation.
+        break
+      }
+      return fmt.Errorf("caps: capbset drop %d: %w", c, err)
+    }
+  }
+
+  return setCaps(append(append([]uintptr{}, keep...), unix.CAP_SETUID, unix.CAP_SETGID))
+}
+
+// FinishDropAll narrows the permitted/effective/inheritable sets down to
+// exactly keep, dropping the CAP_SETUID/CAP_SETGID that DropAll left in
+// place. Call it right after the uid/gid switch completes, before exec'ing
+// the sandboxed command.
+func FinishDropAll(keep []uintptr) error {
+  return setCaps(keep)
+}
+
+func setCaps(keep []uintptr) error {
+  hdr := unix.CapUserHeader{Version: unix.LINUX_CAPABILITY_VERSION_3}
+  var data [2]unix.CapUserData
+  for _, c := range keep {
+    setCapBit(&data, c)
+  }
+  if err := unix.Capset(&hdr, &data[0]); err != nil {
+    if errors.Is(err, unix.EPERM) {
+      return nil
+    }
+    return fmt.Errorf("caps: capset: %w", err)
+  }
+  return nil
+}
+
+func setCapBit(data *[2]unix.CapUserData, cap uintptr) {
+  data[cap/32].Effective |= uint32(1) << (cap % 32)
+  data[cap/32].Permitted |= uint32(1) << (cap % 32)
+  data[cap/32].Inheritable |= uint32(1) << (cap % 32)
+}
+
+// lastCap reads the highest capability number the running kernel knows
+// about from /proc/sys/kernel/cap_last_cap, so DropAll drops exactly the
+// bounding set this kernel supports instead of a hardcoded guess that could
+// under- or over-shoot on a newer/older kernel.
+func lastCap() (uintptr, error) {
+  raw, err := os.ReadFile("/proc/sys/kernel/cap_last_cap")
+  if err != nil {
+    return 0, fmt.Errorf("caps: read cap_last_cap: %w", err)
+  }
+  n, err := strconv.Atoi(strings.TrimSpace(string(raw)))
+  if err != nil {
+    return 0, fmt.Errorf("caps: parse cap_last_cap: %w", err)
+  }
+  return uintptr(n), nil
+}
@@ -0,0 +1,139 @@
+// Package cgroup places an exec'd command into a per-invocation cgroup v2
+// slice so a runaway codex/claude process can't exhaust host RAM, fork-bomb,
+// or starve disk IO even though landlock/seccomp say nothing about resource
+// limits.
+package cgroup
+
+import (
+  "bufio"
+  "fmt"
+  "os"
+  "path/filepath"
+  "strconv"
+  "strings"
+)
+
+const cgroupRoot = "/sys/fs/cgroup"
+const sliceName = "vibe80.slice"
+
+// controllers is the full set of subtree_control knobs this package may
+// write to; they must be enabled in every ancestor cgroup before a leaf
+// cgroup can set the matching limit.
+var controllers = []string{"memory", "pids", "cpu", "io"}
+
+// Cgroup is a single per-invocation cgroup v2 directory.
+type Cgroup struct {
+  dir string
+}
+
+// New creates /sys/fs/cgroup/vibe80.slice/<workspaceID>-<id>, enabling the
+// controllers this package manages on every ancestor along the way. id only
+// needs to be unique per invocation (the caller's session ID works well);
+// unlike the pid this cgroup will eventually hold, it has to be known
+// before that process exists, since New is meant to run before Start.
+func New(workspaceID, id string) (*Cgroup, error) {
+  sliceDir := filepath.Join(cgroupRoot, sliceName)
+  if err := os.MkdirAll(sliceDir, 0o755); err != nil {
+    return nil, fmt.Errorf("cgroup: mkdir %s: %w", sliceDir, err)
+  }
+  if err := enableControllers(cgroupRoot); err != nil {
+    return nil, err
+  }
+  if err := enableControllers(sliceDir); err != nil {
+    return nil, err
+  }
+
+  dir := filepath.Join(sliceDir, fmt.Sprintf("%s-%s", workspaceID, id))
+  if err := os.Mkdir(dir, 0o755); err != nil {
+    return nil, fmt.Errorf("cgroup: mkdir %s: %w", dir, err)
+  }
+  return &Cgroup{dir: dir}, nil
+}
+
+func enableControllers(dir string) error {
+  var enable strings.Builder
+  for _, c := range controllers {
+    enable.WriteString("+" + c + " ")
+  }
+  return writeFile(filepath.Join(dir, "cgroup.subtree_control"), strings.TrimSpace(enable.String()))
+}
+
+// SetMemoryMax writes memory.max, e.g. "536870912" or "max".
+func (c *Cgroup) SetMemoryMax(value string) error {
+  return writeFile(filepath.Join(c.dir, "memory.max"), value)
+}
+
+// SetPidsMax writes pids.max, e.g. "256" or "max".
+func (c *Cgroup) SetPidsMax(value string) error {
+  return writeFile(filepath.Join(c.dir, "pids.max"), value)
+}
+
+// SetCPUMax writes cpu.max as "quota period" (microseconds), e.g. "50000
+// 100000" for half a core.
+func (c *Cgroup) SetCPUMax(quotaPeriod string) error {
+  return writeFile(filepath.Join(c.dir, "cpu.max"), quotaPeriod)
+}
+
+// SetIOMax writes one io.max line, e.g. "8:0 rbps=1048576 wbps=1048576".
+func (c *Cgroup) SetIOMax(line string) error {
+  return writeFile(filepath.Join(c.dir, "io.max"), line)
+}
+
+// AddProcess moves pid into this cgroup. Prefer OpenDirFD plus
+// syscall.SysProcAttr.CgroupFD so a child is born into the cgroup via
+// clone3(CLONE_INTO_CGROUP) and is never outside its limits, even for an
+// instant; this is for adding an already-running process that wasn't
+// started that way.
+func (c *Cgroup) AddProcess(pid int) error {
+  return writeFile(filepath.Join(c.dir, "cgroup.procs"), strconv.Itoa(pid))
+}
+
+// OpenDirFD opens this cgroup's directory for use with
+// syscall.SysProcAttr.CgroupFD (alongside UseCgroupFD: true), so the
+// caller's child is placed into the cgroup at clone(2) time instead of via
+// a cgroup.procs write after Start() returns.
+func (c *Cgroup) OpenDirFD() (*os.File, error) {
+  f, err := os.Open(c.dir)
+  if err != nil {
+    return nil, fmt.Errorf("cgroup: open %s: %w", c.dir, err)
+  }
+  return f, nil
+}
+
+// OOMKilled reports whether the kernel OOM-killed anything in this cgroup,
+// by reading the oom_kill counter out of memory.events.
+func (c *Cgroup) OOMKilled() (bool, error) {
+  f, err := os.Open(filepath.Join(c.dir, "memory.events"))
+  if err != nil {
+    return false, fmt.Errorf("cgroup: open memory.events: %w", err)
+  }
+  defer f.Close()
+
+  scanner := bufio.NewScanner(f)
+  for scanner.Scan() {
+    fields := strings.Fields(scanner.Text())
+    if len(fields) != 2 || fields[0] != "oom_kill" {
+      continue
+    }
+    count, err := strconv.Atoi(fields[1])
+    if err != nil {
+      return false, nil
+    }
+    return count > 0, nil
+  }
+  return false, scanner.Err()
+}
+
+// Remove deletes the cgroup directory. The kernel refuses to rmdir a
+// cgroup with live processes in it, so this is only expected to succeed
+// after the child has exited.
+func (c *Cgroup) Remove() error {
+  return os.Remove(c.dir)
+}
+
+func writeFile(path, value string) error {
+  if err := os.WriteFile(path, []byte(value), 0o644); err != nil {
+    return fmt.Errorf("cgroup: write %s: %w", path, err)
+  }
+  return nil
+}
@@ -0,0 +1,105 @@
+// Package launchspec decodes the OCI-runtime-style JSON document accepted
+// by vibe80-run-as's --spec flag, so callers can describe an entire
+// invocation as a single file instead of a long flag list.
+package launchspec
+
+import (
+  "encoding/json"
+  "fmt"
+  "os"
+)
+
+// Spec is the whole --spec document. Every field except Hooks mirrors one
+// of vibe80-run-as's existing flags; see mergeSpec in
+// tools/vibe80-run-as/spec.go for how each one merges with its CLI
+// counterpart.
+type Spec struct {
+  WorkspaceID  string            `json:"workspaceId"`
+  Cwd          string            `json:"cwd"`
+  Command      *Command          `json:"command"`
+  Env          map[string]string `json:"env"`
+  Mounts       []Mount           `json:"mounts"`
+  Network      *Network          `json:"network"`
+  Seccomp      *Seccomp          `json:"seccomp"`
+  Cgroups      *Cgroups          `json:"cgroups"`
+  Capabilities *Capabilities     `json:"capabilities"`
+  TTY          bool              `json:"tty"`
+  Hooks        *Hooks            `json:"hooks"`
+}
+
+// Command is the program to run and the arguments to pass it, equivalent to
+// the trailing `-- <command> <args...>` of the flag-based invocation.
+type Command struct {
+  Path string   `json:"path"`
+  Args []string `json:"args"`
+}
+
+// Mount mirrors one --allow-ro/--allow-rw/--allow-ro-file/--allow-rw-file
+// entry: Mode is "ro" or "rw", Kind is "dir" or "file".
+type Mount struct {
+  Path string `json:"path"`
+  Mode string `json:"mode"`
+  Kind string `json:"kind"`
+}
+
+// Network mirrors --net: Mode is "none", "tcp", or "bind", and Ports is
+// only meaningful for the latter two.
+type Network struct {
+  Mode  string `json:"mode"`
+  Ports []int  `json:"ports"`
+}
+
+// Seccomp mirrors --seccomp-profile.
+type Seccomp struct {
+  ProfilePath string `json:"profilePath"`
+}
+
+// Cgroups mirrors the four --cgroup-*-max flags.
+type Cgroups struct {
+  MemoryMax string `json:"memoryMax"`
+  PidsMax   string `json:"pidsMax"`
+  CPUMax    string `json:"cpuMax"`
+  IOMax     string `json:"ioMax"`
+}
+
+// Capabilities mirrors --cap-add. vibe80-run-as doesn't distinguish the
+// bounding set from the effective set the way the OCI spec does, so both
+// lists end up merged into the single allowlist caps.Parse checks.
+type Capabilities struct {
+  Bounding  []string `json:"bounding"`
+  Effective []string `json:"effective"`
+}
+
+// HookEntry is a single hook invocation: the binary to run and its
+// arguments, matching the OCI runtime-spec hook shape.
+type HookEntry struct {
+  Path string   `json:"path"`
+  Args []string `json:"args"`
+}
+
+// Hooks holds the prestart and poststop hook lists, run in order in the
+// parent process (see runHooks in tools/vibe80-run-as/hooks.go).
+type Hooks struct {
+  Prestart []HookEntry `json:"prestart"`
+  Poststop []HookEntry `json:"poststop"`
+}
+
+// Load reads and strictly decodes a launch spec from path. Fields outside
+// the schema above are rejected rather than silently ignored, since a typo
+// in a security-relevant spec (e.g. "mounts" misspelled) should fail loudly
+// instead of quietly doing nothing.
+func Load(path string) (*Spec, error) {
+  f, err := os.Open(path)
+  if err != nil {
+    return nil, fmt.Errorf("launchspec: open %q: %w", path, err)
+  }
+  defer f.Close()
+
+  var spec Spec
+  dec := json.NewDecoder(f)
+  dec.DisallowUnknownFields()
+  if err := dec.Decode(&spec); err != nil {
+    return nil, fmt.Errorf("launchspec: parse %q: %w", path, err)
+  }
+  return &spec, nil
+}
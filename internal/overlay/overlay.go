@@ -0,0 +1,105 @@
+// Package overlay mounts a per-invocation overlayfs over a workspace's root
+// directory, so a sandboxed command's writes land in a disposable upperdir
+// instead of the real tree. The persistent form leaves that upperdir behind
+// for the vibe80-root "overlay commit"/"overlay discard" subcommands to
+// merge or throw away later; those subcommands look for it only under
+// Dir(workspaceRootDir), so a persistent upperdir anywhere else is not
+// found by them. The ephemeral form backs it with a tmpfs that vanishes
+// with the mount namespace on exit.
+package overlay
+
+import (
+  "fmt"
+  "os"
+  "path/filepath"
+  "strings"
+
+  "golang.org/x/sys/unix"
+)
+
+// Spec describes one overlay mount. Ephemeral specs get a tmpfs-backed
+// upperdir/workdir created fresh inside the new mount namespace; persistent
+// specs point at caller-supplied directories that outlive the invocation.
+type Spec struct {
+  Ephemeral bool
+  UpperDir  string
+  WorkDir   string
+}
+
+// Dir returns the canonical sibling directory vibe80-root's "overlay
+// commit"/"overlay discard" subcommands use to find a persistent overlay's
+// upper/work directories for workspaceRootDir, without the caller having to
+// pass them explicitly.
+func Dir(workspaceRootDir string) string {
+  return workspaceRootDir + ".overlay"
+}
+
+// ParseFlag parses a --overlay flag value: either "ephemeral", or a
+// "upper=<dir>,work=<dir>" pair naming a persistent overlay's directories.
+func ParseFlag(raw string) (Spec, error) {
+  if raw == "ephemeral" {
+    return Spec{Ephemeral: true}, nil
+  }
+  var spec Spec
+  for _, part := range strings.Split(raw, ",") {
+    key, value, ok := strings.Cut(part, "=")
+    if !ok {
+      return Spec{}, fmt.Errorf("overlay: invalid --overlay value %q", raw)
+    }
+    switch key {
+    case "upper":
+      spec.UpperDir = value
+    case "work":
+      spec.WorkDir = value
+    default:
+      return Spec{}, fmt.Errorf("overlay: unknown --overlay key %q", key)
+    }
+  }
+  if spec.UpperDir == "" || spec.WorkDir == "" {
+    return Spec{}, fmt.Errorf(`overlay: --overlay requires "upper=<dir>,work=<dir>" or "ephemeral"`)
+  }
+  return spec, nil
+}
+
+// Mount enters a new mount namespace, detaches it from the host's mount
+// propagation, and mounts an overlayfs over lowerDir using spec's
+// upperdir/workdir (generating a tmpfs-backed pair first if spec is
+// ephemeral). It must run before any path-based sandboxing (landlock) is
+// applied, since landlock's rules are resolved against whatever is mounted
+// at lowerDir at the time they're added.
+func Mount(lowerDir string, spec Spec) error {
+  if err := unix.Unshare(unix.CLONE_NEWNS); err != nil {
+    return fmt.Errorf("overlay: unshare mount namespace: %w", err)
+  }
+  // Without this, the mounts below would propagate back out to the host's
+  // mount table; MS_SLAVE keeps host mounts flowing in without anything of
+  // ours leaking out.
+  if err := unix.Mount("", "/", "", unix.MS_REC|unix.MS_SLAVE, ""); err != nil {
+    return fmt.Errorf("overlay: set / to MS_SLAVE: %w", err)
+  }
+
+  upperDir, workDir := spec.UpperDir, spec.WorkDir
+  if spec.Ephemeral {
+    tmpfsDir, err := os.MkdirTemp("", "vibe80-overlay-")
+    if err != nil {
+      return fmt.Errorf("overlay: create tmpfs mountpoint: %w", err)
+    }
+    if err := unix.Mount("tmpfs", tmpfsDir, "tmpfs", 0, ""); err != nil {
+      return fmt.Errorf("overlay: mount tmpfs: %w", err)
+    }
+    upperDir = filepath.Join(tmpfsDir, "upper")
+    workDir = filepath.Join(tmpfsDir, "work")
+  }
+  if err := os.MkdirAll(upperDir, 0o700); err != nil {
+    return fmt.Errorf("overlay: create upperdir: %w", err)
+  }
+  if err := os.MkdirAll(workDir, 0o700); err != nil {
+    return fmt.Errorf("overlay: create workdir: %w", err)
+  }
+
+  options := fmt.Sprintf("lowerdir=%s,upperdir=%s,workdir=%s", lowerDir, upperDir, workDir)
+  if err := unix.Mount("overlay", lowerDir, "overlay", 0, options); err != nil {
+    return fmt.Errorf("overlay: mount overlayfs on %s: %w", lowerDir, err)
+  }
+  return nil
+}
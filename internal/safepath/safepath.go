@@ -0,0 +1,157 @@
+// Package safepath resolves paths beneath a trusted anchor directory without
+// following symlinks that could escape it, closing the TOCTOU window between
+// validating a path and handing it to exec/chown.
+package safepath
+
+import (
+  "errors"
+  "fmt"
+  "path/filepath"
+  "strings"
+
+  "golang.org/x/sys/unix"
+)
+
+// SafePath is a path resolved beneath an anchor, held open as a file
+// descriptor so later operations (cmd.Dir, fchdir, chown) cannot be raced by
+// a symlink swapped in after resolution.
+type SafePath struct {
+  fd   int
+  path string
+}
+
+// FD returns the open O_PATH descriptor backing this SafePath.
+func (s *SafePath) FD() int {
+  return s.fd
+}
+
+// ProcPath returns a /proc/self/fd/N reference usable anywhere a path is
+// expected (cmd.Dir, os.Open, etc.) without re-walking the original path.
+func (s *SafePath) ProcPath() string {
+  return fmt.Sprintf("/proc/self/fd/%d", s.fd)
+}
+
+// Close releases the underlying file descriptor.
+func (s *SafePath) Close() error {
+  if s.fd < 0 {
+    return nil
+  }
+  fd := s.fd
+  s.fd = -1
+  return unix.Close(fd)
+}
+
+// Resolve opens rel component-by-component beneath anchorDir, refusing to
+// follow any symlink (including "magic links" under /proc) that would leave
+// the anchor. rel must be relative; ".." components are rejected outright.
+func Resolve(anchorDir, rel string) (*SafePath, error) {
+  cleaned := filepath.Clean(rel)
+  if filepath.IsAbs(cleaned) {
+    return nil, fmt.Errorf("safepath: rel must not be absolute: %q", rel)
+  }
+  if cleaned == "." {
+    return openAnchor(anchorDir)
+  }
+  for _, part := range strings.Split(cleaned, string(filepath.Separator)) {
+    if part == ".." {
+      return nil, fmt.Errorf("safepath: %q escapes anchor", rel)
+    }
+  }
+
+  anchor, err := openAnchor(anchorDir)
+  if err != nil {
+    return nil, err
+  }
+  defer anchor.Close()
+
+  if openat2Supported() {
+    return resolveOpenat2(anchor.fd, cleaned)
+  }
+  return resolveWalk(anchor.fd, cleaned)
+}
+
+// ResolveAbs is Resolve for an absolute target known to live under
+// anchorDir; it computes the relative suffix and delegates to Resolve.
+func ResolveAbs(anchorDir, target string) (*SafePath, error) {
+  rel, err := filepath.Rel(anchorDir, target)
+  if err != nil {
+    return nil, err
+  }
+  return Resolve(anchorDir, rel)
+}
+
+func openAnchor(anchorDir string) (*SafePath, error) {
+  fd, err := unix.Open(anchorDir, unix.O_PATH|unix.O_DIRECTORY|unix.O_CLOEXEC, 0)
+  if err != nil {
+    return nil, fmt.Errorf("safepath: open anchor %q: %w", anchorDir, err)
+  }
+  return &SafePath{fd: fd, path: anchorDir}, nil
+}
+
+// resolveOpenat2 does the whole walk in one syscall using RESOLVE_BENEATH,
+// which the kernel enforces even across racing renames/symlinks.
+func resolveOpenat2(anchorFD int, rel string) (*SafePath, error) {
+  how := unix.OpenHow{
+    Flags:   unix.O_PATH | unix.O_CLOEXEC,
+    Resolve: unix.RESOLVE_BENEATH | unix.RESOLVE_NO_MAGICLINKS | unix.RESOLVE_NO_XDEV,
+  }
+  fd, err := unix.Openat2(anchorFD, rel, &how)
+  if err != nil {
+    return nil, fmt.Errorf("safepath: openat2 %q: %w", rel, err)
+  }
+  return &SafePath{fd: fd, path: rel}, nil
+}
+
+// resolveWalk is the openat2-less fallback: open each component with
+// O_NOFOLLOW relative to the fd of the previous component, so a symlink
+// swapped into any intermediate directory fails closed instead of being
+// followed. A symlink as the final component is rejected as well.
+func resolveWalk(anchorFD int, rel string) (*SafePath, error) {
+  parts := strings.Split(rel, string(filepath.Separator))
+  curFD := anchorFD
+  closeCur := false
+  defer func() {
+    if closeCur {
+      unix.Close(curFD)
+    }
+  }()
+
+  for i, part := range parts {
+    flags := unix.O_PATH | unix.O_NOFOLLOW | unix.O_CLOEXEC
+    if i < len(parts)-1 {
+      flags |= unix.O_DIRECTORY
+    }
+    fd, err := unix.Openat(curFD, part, flags, 0)
+    if err != nil {
+      return nil, fmt.Errorf("safepath: openat %q: %w", part, err)
+    }
+    if closeCur {
+      unix.Close(curFD)
+    }
+    curFD = fd
+    closeCur = true
+  }
+
+  // O_PATH|O_NOFOLLOW opens a final-component symlink itself rather than
+  // failing, so check for that explicitly.
+  var st unix.Stat_t
+  if err := unix.Fstat(curFD, &st); err != nil {
+    return nil, fmt.Errorf("safepath: fstat %q: %w", rel, err)
+  }
+  if st.Mode&unix.S_IFMT == unix.S_IFLNK {
+    return nil, fmt.Errorf("safepath: %q is a symlink", rel)
+  }
+
+  closeCur = false
+  return &SafePath{fd: curFD, path: rel}, nil
+}
+
+func openat2Supported() bool {
+  how := unix.OpenHow{Flags: unix.O_PATH | unix.O_CLOEXEC}
+  fd, err := unix.Openat2(unix.AT_FDCWD, ".", &how)
+  if err != nil {
+    return !errors.Is(err, unix.ENOSYS)
+  }
+  unix.Close(fd)
+  return true
+}
@@ -0,0 +1,68 @@
+package safepath
+
+import (
+  "os"
+  "path/filepath"
+  "testing"
+)
+
+func TestResolveRejectsDotDot(t *testing.T) {
+  dir := t.TempDir()
+  if _, err := Resolve(dir, "../etc"); err == nil {
+    t.Fatal("expected error for a rel containing .., got nil")
+  }
+}
+
+func TestResolveRejectsAbsolute(t *testing.T) {
+  dir := t.TempDir()
+  if _, err := Resolve(dir, "/etc/passwd"); err == nil {
+    t.Fatal("expected error for an absolute rel, got nil")
+  }
+}
+
+func TestResolveRejectsSymlinkEscape(t *testing.T) {
+  anchor := t.TempDir()
+  outside := t.TempDir()
+  target := filepath.Join(outside, "secret")
+  if err := os.WriteFile(target, []byte("x"), 0o600); err != nil {
+    t.Fatalf("write target: %v", err)
+  }
+  link := filepath.Join(anchor, "escape")
+  if err := os.Symlink(target, link); err != nil {
+    t.Fatalf("symlink: %v", err)
+  }
+
+  if _, err := Resolve(anchor, "escape"); err == nil {
+    t.Fatal("expected error resolving a symlink that escapes the anchor, got nil")
+  }
+}
+
+func TestResolveRejectsSymlinkViaIntermediateDir(t *testing.T) {
+  anchor := t.TempDir()
+  outside := t.TempDir()
+  link := filepath.Join(anchor, "escape-dir")
+  if err := os.Symlink(outside, link); err != nil {
+    t.Fatalf("symlink: %v", err)
+  }
+
+  if _, err := Resolve(anchor, "escape-dir/inside"); err == nil {
+    t.Fatal("expected error walking through a symlinked intermediate directory, got nil")
+  }
+}
+
+func TestResolveOpensFileBeneathAnchor(t *testing.T) {
+  anchor := t.TempDir()
+  if err := os.WriteFile(filepath.Join(anchor, "file"), []byte("x"), 0o600); err != nil {
+    t.Fatalf("write file: %v", err)
+  }
+
+  sp, err := Resolve(anchor, "file")
+  if err != nil {
+    t.Fatalf("Resolve failed: %v", err)
+  }
+  defer sp.Close()
+
+  if sp.FD() < 0 {
+    t.Fatal("expected a valid file descriptor")
+  }
+}
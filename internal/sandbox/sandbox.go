@@ -0,0 +1,85 @@
+// Package sandbox applies the baseline Landlock filesystem confinement that
+// every exec'd workspace command runs under: read+execute on the base
+// system, read+write under the workspace itself, and nothing else. Callers
+// may widen it with additional caller-specific paths (e.g. --allow-rw) and
+// net rules, but the baseline is never opt-in.
+package sandbox
+
+import (
+  "fmt"
+
+  landlock "github.com/landlock-lsm/go-landlock/landlock"
+)
+
+// baseReadDirs are readable+executable on every invocation so the resolved
+// command and its shared libraries can actually run.
+var baseReadDirs = []string{
+  "/usr",
+  "/bin",
+  "/lib",
+  "/lib64",
+  "/etc",
+}
+
+// Config describes the filesystem confinement to apply before the child is
+// exec'd.
+type Config struct {
+  HomeDir          string
+  WorkspaceRootDir string
+  // TmpDir is granted read+write when the operator points TMPDIR somewhere
+  // outside HomeDir/WorkspaceRootDir via --env; those are already RW, so
+  // this only matters when TMPDIR is set to something else.
+  TmpDir           string
+  ExtraRO          []string
+  ExtraRW          []string
+  ExtraROFiles     []string
+  ExtraRWFiles     []string
+  NetRules         []landlock.Rule
+}
+
+// Apply restricts the calling process (and everything it execs from this
+// point on, since Landlock rules are inherited across exec) to Config's
+// baseline plus any caller-supplied extras. It degrades best-effort on
+// kernels whose Landlock ABI doesn't support every requested rule (e.g.
+// < 5.13, which lacks Landlock entirely) rather than failing closed, so an
+// older kernel still gets whatever partial confinement it can enforce.
+func Apply(cfg Config) error {
+  ro := uniqueNonEmpty(append(append([]string{}, baseReadDirs...), cfg.ExtraRO...))
+  rw := uniqueNonEmpty(append([]string{cfg.HomeDir, cfg.WorkspaceRootDir, cfg.TmpDir}, cfg.ExtraRW...))
+  roFiles := uniqueNonEmpty(cfg.ExtraROFiles)
+  rwFiles := uniqueNonEmpty(cfg.ExtraRWFiles)
+
+  ruleset := landlock.V6.BestEffort()
+  if err := ruleset.RestrictPaths(
+    landlock.RODirs(ro...),
+    landlock.RWDirs(rw...),
+    landlock.ROFiles(roFiles...),
+    landlock.RWFiles(rwFiles...),
+  ); err != nil {
+    return fmt.Errorf("sandbox: restrict paths: %w", err)
+  }
+
+  if len(cfg.NetRules) == 0 {
+    return nil
+  }
+  if err := ruleset.RestrictNet(cfg.NetRules...); err != nil {
+    return fmt.Errorf("sandbox: restrict net: %w", err)
+  }
+  return nil
+}
+
+func uniqueNonEmpty(values []string) []string {
+  seen := make(map[string]struct{}, len(values))
+  result := make([]string, 0, len(values))
+  for _, v := range values {
+    if v == "" {
+      continue
+    }
+    if _, ok := seen[v]; ok {
+      continue
+    }
+    seen[v] = struct{}{}
+    result = append(result, v)
+  }
+  return result
+}
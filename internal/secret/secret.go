@@ -0,0 +1,106 @@
+// Package secret reads a length-prefixed stream of KEY=VALUE pairs (passed
+// over a dedicated file descriptor or file, never argv or a regular --env
+// flag) and materializes the allowed ones into per-invocation files so
+// downstream tools like git can reference them without the values ever
+// touching an env dump or the session journal.
+package secret
+
+import (
+  "bytes"
+  "encoding/binary"
+  "fmt"
+  "io"
+  "os"
+  "path/filepath"
+  "runtime"
+)
+
+// maxPairSize bounds a single framed record so a malformed or hostile
+// sender can't make us allocate without limit.
+const maxPairSize = 1 << 20
+
+// Pair is one KEY=VALUE secret read from the framed stream. Key and Value
+// share backing storage with the original read buffer so Wipe can zero
+// both in one pass.
+type Pair struct {
+  Key   []byte
+  Value []byte
+}
+
+// ReadFramed reads a sequence of [4-byte big-endian length][KEY=VALUE
+// bytes] records until EOF.
+func ReadFramed(r io.Reader) ([]Pair, error) {
+  var pairs []Pair
+  for {
+    var lenBuf [4]byte
+    if _, err := io.ReadFull(r, lenBuf[:]); err != nil {
+      if err == io.EOF {
+        break
+      }
+      return nil, fmt.Errorf("secret: read length prefix: %w", err)
+    }
+    n := binary.BigEndian.Uint32(lenBuf[:])
+    if n == 0 || n > maxPairSize {
+      return nil, fmt.Errorf("secret: record size %d out of range", n)
+    }
+    buf := make([]byte, n)
+    if _, err := io.ReadFull(r, buf); err != nil {
+      return nil, fmt.Errorf("secret: read record: %w", err)
+    }
+    idx := bytes.IndexByte(buf, '=')
+    if idx < 0 {
+      return nil, fmt.Errorf("secret: malformed record (no '=')")
+    }
+    pairs = append(pairs, Pair{Key: buf[:idx], Value: buf[idx+1:]})
+  }
+  return pairs, nil
+}
+
+// Validate rejects any pair whose key isn't in allowed.
+func Validate(pairs []Pair, allowed map[string]struct{}) error {
+  for _, p := range pairs {
+    if _, ok := allowed[string(p.Key)]; !ok {
+      return fmt.Errorf("secret: disallowed key %q", p.Key)
+    }
+  }
+  return nil
+}
+
+// Materialize writes each pair's value to <dir>/<key>, mode 0600, owned by
+// uid:gid, and returns a key -> path map. dir is created with mode 0700.
+func Materialize(dir string, uid, gid int, pairs []Pair) (map[string]string, error) {
+  if err := os.MkdirAll(dir, 0o700); err != nil {
+    return nil, fmt.Errorf("secret: mkdir %s: %w", dir, err)
+  }
+  if err := os.Chown(dir, uid, gid); err != nil {
+    return nil, fmt.Errorf("secret: chown %s: %w", dir, err)
+  }
+
+  paths := make(map[string]string, len(pairs))
+  for _, p := range pairs {
+    key := string(p.Key)
+    path := filepath.Join(dir, key)
+    if err := os.WriteFile(path, p.Value, 0o600); err != nil {
+      return nil, fmt.Errorf("secret: write %s: %w", path, err)
+    }
+    if err := os.Chown(path, uid, gid); err != nil {
+      return nil, fmt.Errorf("secret: chown %s: %w", path, err)
+    }
+    paths[key] = path
+  }
+  return paths, nil
+}
+
+// Wipe zeroes the backing buffers of every pair so the secret values don't
+// linger in process memory once they've been materialized to disk.
+func Wipe(pairs []Pair) {
+  for i := range pairs {
+    for j := range pairs[i].Value {
+      pairs[i].Value[j] = 0
+    }
+    for j := range pairs[i].Key {
+      pairs[i].Key[j] = 0
+    }
+  }
+  runtime.KeepAlive(pairs)
+}
@@ -0,0 +1,79 @@
+package secret
+
+import (
+  "os"
+  "path/filepath"
+  "testing"
+)
+
+func TestValidateRejectsDisallowedKey(t *testing.T) {
+  allowed := map[string]struct{}{"GIT_TOKEN": {}}
+  pairs := []Pair{{Key: []byte("SSH_KEY"), Value: []byte("x")}}
+  if err := Validate(pairs, allowed); err == nil {
+    t.Fatal("expected error for a disallowed key, got nil")
+  }
+}
+
+func TestValidateAcceptsAllowedKey(t *testing.T) {
+  allowed := map[string]struct{}{"GIT_TOKEN": {}}
+  pairs := []Pair{{Key: []byte("GIT_TOKEN"), Value: []byte("x")}}
+  if err := Validate(pairs, allowed); err != nil {
+    t.Fatalf("unexpected error: %v", err)
+  }
+}
+
+func TestMaterializeWritesRestrictedFiles(t *testing.T) {
+  dir := filepath.Join(t.TempDir(), "secrets")
+  pairs := []Pair{{Key: []byte("GIT_TOKEN"), Value: []byte("hunter2")}}
+
+  paths, err := Materialize(dir, os.Getuid(), os.Getgid(), pairs)
+  if err != nil {
+    t.Fatalf("Materialize failed: %v", err)
+  }
+
+  path, ok := paths["GIT_TOKEN"]
+  if !ok {
+    t.Fatal("expected GIT_TOKEN in the returned path map")
+  }
+
+  info, err := os.Stat(path)
+  if err != nil {
+    t.Fatalf("stat secret file: %v", err)
+  }
+  if info.Mode().Perm() != 0o600 {
+    t.Fatalf("expected secret file mode 0600, got %o", info.Mode().Perm())
+  }
+
+  dirInfo, err := os.Stat(dir)
+  if err != nil {
+    t.Fatalf("stat secret dir: %v", err)
+  }
+  if dirInfo.Mode().Perm() != 0o700 {
+    t.Fatalf("expected secret dir mode 0700, got %o", dirInfo.Mode().Perm())
+  }
+
+  got, err := os.ReadFile(path)
+  if err != nil {
+    t.Fatalf("read secret file: %v", err)
+  }
+  if string(got) != "hunter2" {
+    t.Fatalf("expected secret file contents %q, got %q", "hunter2", got)
+  }
+}
+
+func TestWipeZeroesKeyAndValue(t *testing.T) {
+  pairs := []Pair{{Key: []byte("GIT_TOKEN"), Value: []byte("hunter2")}}
+
+  Wipe(pairs)
+
+  for _, b := range pairs[0].Key {
+    if b != 0 {
+      t.Fatal("expected every key byte to be zeroed")
+    }
+  }
+  for _, b := range pairs[0].Value {
+    if b != 0 {
+      t.Fatal("expected every value byte to be zeroed")
+    }
+  }
+}
@@ -0,0 +1,91 @@
+// Package session records one JSON file per vibe80-run-as invocation under a
+// workspace's sessions/ directory, turning it into an auditable exec
+// history that operators can grep across all workspaces.
+package session
+
+import (
+  "encoding/json"
+  "fmt"
+  "os"
+  "path/filepath"
+  "syscall"
+  "time"
+
+  "vibe80/vibe80/internal/ulid"
+)
+
+// Record is the structured journal entry written for a single invocation.
+type Record struct {
+  ID        string    `json:"id"`
+  StartedAt time.Time `json:"started_at"`
+  EndedAt   time.Time `json:"ended_at"`
+  Command   string    `json:"command"`
+  Args      []string  `json:"args"`
+  Env       []string  `json:"env"`
+  Cwd       string    `json:"cwd"`
+  ExitCode  int       `json:"exit_code"`
+  Rusage    *Rusage   `json:"rusage,omitempty"`
+}
+
+// Rusage is the subset of cmd.ProcessState's rusage worth persisting.
+type Rusage struct {
+  UserTimeSeconds   float64 `json:"user_time_seconds"`
+  SystemTimeSeconds float64 `json:"system_time_seconds"`
+  MaxRSSKB          int64   `json:"max_rss_kb"`
+}
+
+// RusageFromProcessState extracts Rusage from an exited command's
+// os.ProcessState, returning nil if that information isn't available on
+// this platform.
+func RusageFromProcessState(state *os.ProcessState) *Rusage {
+  if state == nil {
+    return nil
+  }
+  ru, ok := state.SysUsage().(*syscall.Rusage)
+  if !ok {
+    return nil
+  }
+  return &Rusage{
+    UserTimeSeconds:   time.Duration(ru.Utime.Nano()).Seconds(),
+    SystemTimeSeconds: time.Duration(ru.Stime.Nano()).Seconds(),
+    MaxRSSKB:          ru.Maxrss,
+  }
+}
+
+// NewID returns a fresh session ULID. Callers that need the ID before the
+// command has finished running (e.g. to place secrets alongside the
+// eventual journal entry) generate it up front and pass it to Write.
+func NewID() (string, error) {
+  id, err := ulid.New()
+  if err != nil {
+    return "", fmt.Errorf("session: new id: %w", err)
+  }
+  return id, nil
+}
+
+// Write writes rec to <sessionsDir>/<id>.json, owned by uid:gid with mode
+// 0640. The file is written to a .tmp sibling and renamed into place so a
+// concurrent tail-sessions reader never observes a partial write.
+func Write(sessionsDir, id string, uid, gid uint32, rec Record) (string, error) {
+  rec.ID = id
+
+  data, err := json.MarshalIndent(rec, "", "  ")
+  if err != nil {
+    return "", fmt.Errorf("session: marshal: %w", err)
+  }
+  data = append(data, '\n')
+
+  path := filepath.Join(sessionsDir, id+".json")
+  tmp := path + ".tmp"
+  if err := os.WriteFile(tmp, data, 0o640); err != nil {
+    return "", fmt.Errorf("session: write %s: %w", tmp, err)
+  }
+  if err := os.Chown(tmp, int(uid), int(gid)); err != nil {
+    os.Remove(tmp)
+    return "", fmt.Errorf("session: chown %s: %w", tmp, err)
+  }
+  if err := os.Rename(tmp, path); err != nil {
+    return "", fmt.Errorf("session: rename %s: %w", tmp, err)
+  }
+  return path, nil
+}
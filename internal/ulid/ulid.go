@@ -0,0 +1,79 @@
+// Package ulid generates ULIDs (Universally Unique Lexicographically
+// Sortable Identifiers): a 48-bit millisecond timestamp followed by 80 bits
+// of randomness, Crockford base32 encoded to 26 characters. Lexical sort
+// order matches creation order to the millisecond (IDs from the same
+// millisecond sort by their random bits), which is what makes them a good
+// session journal filename: `ls sessions/` is already in chronological
+// order.
+package ulid
+
+import (
+  "crypto/rand"
+  "fmt"
+  "time"
+)
+
+const crockfordAlphabet = "0123456789ABCDEFGHJKMNPQRSTVWXYZ"
+
+// New returns a ULID for the current time.
+func New() (string, error) {
+  return NewWithTime(time.Now())
+}
+
+// NewWithTime returns a ULID for the given time, useful for tests.
+func NewWithTime(t time.Time) (string, error) {
+  var entropy [10]byte
+  if _, err := rand.Read(entropy[:]); err != nil {
+    return "", fmt.Errorf("ulid: read entropy: %w", err)
+  }
+
+  ms := uint64(t.UnixMilli())
+  if ms >= (1 << 48) {
+    return "", fmt.Errorf("ulid: timestamp overflows 48 bits")
+  }
+
+  var buf [16]byte
+  buf[0] = byte(ms >> 40)
+  buf[1] = byte(ms >> 32)
+  buf[2] = byte(ms >> 24)
+  buf[3] = byte(ms >> 16)
+  buf[4] = byte(ms >> 8)
+  buf[5] = byte(ms)
+  copy(buf[6:], entropy[:])
+
+  return encode(buf), nil
+}
+
+// encode base32-Crockford-encodes the 128-bit ULID payload into 26 chars.
+func encode(buf [16]byte) string {
+  var out [26]byte
+  out[0] = crockfordAlphabet[(buf[0]&224)>>5]
+  out[1] = crockfordAlphabet[buf[0]&31]
+  out[2] = crockfordAlphabet[(buf[1]&248)>>3]
+  out[3] = crockfordAlphabet[((buf[1]&7)<<2)|((buf[2]&192)>>6)]
+  out[4] = crockfordAlphabet[(buf[2]&62)>>1]
+  out[5] = crockfordAlphabet[((buf[2]&1)<<4)|((buf[3]&240)>>4)]
+  out[6] = crockfordAlphabet[((buf[3]&15)<<1)|((buf[4]&128)>>7)]
+  out[7] = crockfordAlphabet[(buf[4]&124)>>2]
+  out[8] = crockfordAlphabet[((buf[4]&3)<<3)|((buf[5]&224)>>5)]
+  out[9] = crockfordAlphabet[buf[5]&31]
+
+  out[10] = crockfordAlphabet[(buf[6]&248)>>3]
+  out[11] = crockfordAlphabet[((buf[6]&7)<<2)|((buf[7]&192)>>6)]
+  out[12] = crockfordAlphabet[(buf[7]&62)>>1]
+  out[13] = crockfordAlphabet[((buf[7]&1)<<4)|((buf[8]&240)>>4)]
+  out[14] = crockfordAlphabet[((buf[8]&15)<<1)|((buf[9]&128)>>7)]
+  out[15] = crockfordAlphabet[(buf[9]&124)>>2]
+  out[16] = crockfordAlphabet[((buf[9]&3)<<3)|((buf[10]&224)>>5)]
+  out[17] = crockfordAlphabet[buf[10]&31]
+  out[18] = crockfordAlphabet[(buf[11]&248)>>3]
+  out[19] = crockfordAlphabet[((buf[11]&7)<<2)|((buf[12]&192)>>6)]
+  out[20] = crockfordAlphabet[(buf[12]&62)>>1]
+  out[21] = crockfordAlphabet[((buf[12]&1)<<4)|((buf[13]&240)>>4)]
+  out[22] = crockfordAlphabet[((buf[13]&15)<<1)|((buf[14]&128)>>7)]
+  out[23] = crockfordAlphabet[(buf[14]&124)>>2]
+  out[24] = crockfordAlphabet[((buf[14]&3)<<3)|((buf[15]&224)>>5)]
+  out[25] = crockfordAlphabet[buf[15]&31]
+
+  return string(out[:])
+}
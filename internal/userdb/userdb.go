@@ -0,0 +1,292 @@
+// Package userdb parses and extends /etc/passwd and /etc/group directly in
+// Go, so workspace provisioning no longer depends on shelling out to
+// id/useradd/getent (absent from minimal, coreutils/shadow-utils-less
+// containers and slow besides). The parsing follows the same layout buildah's
+// chrootuser package uses for chrooted rootfs passwd/group files.
+package userdb
+
+import (
+  "bufio"
+  "fmt"
+  "os"
+  "path/filepath"
+  "strconv"
+  "strings"
+
+  "golang.org/x/sys/unix"
+)
+
+const (
+  // DefaultMinUID is the first UID handed out by AllocateUID when the
+  // workspace has no pinned ID.
+  DefaultMinUID = 100000
+  // DefaultMaxUID bounds the allocation range.
+  DefaultMaxUID = 200000
+)
+
+// User is a single /etc/passwd record.
+type User struct {
+  Name  string
+  UID   int
+  GID   int
+  Gecos string
+  Home  string
+  Shell string
+}
+
+// Group is a single /etc/group record.
+type Group struct {
+  Name    string
+  GID     int
+  Members []string
+}
+
+// root returns the directory /etc/passwd and /etc/group are read from.
+// WORKSPACE_HOME_BASE doubles as the chroot-style root so the same binary
+// can provision workspaces whose passwd/group files live under an
+// alternate prefix; it defaults to "/".
+func root() string {
+  if base := os.Getenv("WORKSPACE_HOME_BASE"); base != "" {
+    return base
+  }
+  return "/"
+}
+
+func passwdPath() string {
+  return filepath.Join(root(), "etc", "passwd")
+}
+
+func groupPath() string {
+  return filepath.Join(root(), "etc", "group")
+}
+
+// LookupUser returns the passwd entry for name, or an error if absent.
+func LookupUser(name string) (*User, error) {
+  users, err := readUsers()
+  if err != nil {
+    return nil, err
+  }
+  for i := range users {
+    if users[i].Name == name {
+      return &users[i], nil
+    }
+  }
+  return nil, fmt.Errorf("userdb: unknown user %q", name)
+}
+
+// LookupGroupByGID returns the group entry with the given GID, if any.
+func LookupGroupByGID(gid int) (*Group, error) {
+  groups, err := readGroups()
+  if err != nil {
+    return nil, err
+  }
+  for i := range groups {
+    if groups[i].GID == gid {
+      return &groups[i], nil
+    }
+  }
+  return nil, fmt.Errorf("userdb: unknown gid %d", gid)
+}
+
+// AllocateUID returns the lowest free UID in [min, max] not already present
+// in /etc/passwd.
+func AllocateUID(min, max int) (int, error) {
+  users, err := readUsers()
+  if err != nil {
+    return 0, err
+  }
+  used := make(map[int]struct{}, len(users))
+  for _, u := range users {
+    used[u.UID] = struct{}{}
+  }
+  for uid := min; uid <= max; uid++ {
+    if _, ok := used[uid]; !ok {
+      return uid, nil
+    }
+  }
+  return 0, fmt.Errorf("userdb: no free uid in [%d, %d]", min, max)
+}
+
+// AllocateGID returns the lowest free GID in [min, max] not already present
+// in /etc/group.
+func AllocateGID(min, max int) (int, error) {
+  groups, err := readGroups()
+  if err != nil {
+    return 0, err
+  }
+  used := make(map[int]struct{}, len(groups))
+  for _, g := range groups {
+    used[g.GID] = struct{}{}
+  }
+  for gid := min; gid <= max; gid++ {
+    if _, ok := used[gid]; !ok {
+      return gid, nil
+    }
+  }
+  return 0, fmt.Errorf("userdb: no free gid in [%d, %d]", min, max)
+}
+
+// AddUser appends u to /etc/passwd under an flock-protected atomic rewrite.
+func AddUser(u User) error {
+  return withLock(passwdPath(), func() error {
+    users, err := readUsers()
+    if err != nil {
+      return err
+    }
+    for _, existing := range users {
+      if existing.Name == u.Name || existing.UID == u.UID {
+        return fmt.Errorf("userdb: user %q or uid %d already exists", u.Name, u.UID)
+      }
+    }
+    line := formatUser(u)
+    return appendLine(passwdPath(), line)
+  })
+}
+
+// AddGroup appends g to /etc/group under an flock-protected atomic rewrite.
+func AddGroup(g Group) error {
+  return withLock(groupPath(), func() error {
+    groups, err := readGroups()
+    if err != nil {
+      return err
+    }
+    for _, existing := range groups {
+      if existing.Name == g.Name || existing.GID == g.GID {
+        return fmt.Errorf("userdb: group %q or gid %d already exists", g.Name, g.GID)
+      }
+    }
+    line := formatGroup(g)
+    return appendLine(groupPath(), line)
+  })
+}
+
+func readUsers() ([]User, error) {
+  f, err := os.Open(passwdPath())
+  if err != nil {
+    return nil, fmt.Errorf("userdb: open passwd: %w", err)
+  }
+  defer f.Close()
+
+  var users []User
+  scanner := bufio.NewScanner(f)
+  for scanner.Scan() {
+    line := strings.TrimSpace(scanner.Text())
+    if line == "" || strings.HasPrefix(line, "#") {
+      continue
+    }
+    fields := strings.Split(line, ":")
+    if len(fields) < 7 {
+      continue
+    }
+    uid, err := strconv.Atoi(fields[2])
+    if err != nil {
+      continue
+    }
+    gid, err := strconv.Atoi(fields[3])
+    if err != nil {
+      continue
+    }
+    users = append(users, User{
+      Name:  fields[0],
+      UID:   uid,
+      GID:   gid,
+      Gecos: fields[4],
+      Home:  fields[5],
+      Shell: fields[6],
+    })
+  }
+  return users, scanner.Err()
+}
+
+func readGroups() ([]Group, error) {
+  f, err := os.Open(groupPath())
+  if err != nil {
+    return nil, fmt.Errorf("userdb: open group: %w", err)
+  }
+  defer f.Close()
+
+  var groups []Group
+  scanner := bufio.NewScanner(f)
+  for scanner.Scan() {
+    line := strings.TrimSpace(scanner.Text())
+    if line == "" || strings.HasPrefix(line, "#") {
+      continue
+    }
+    fields := strings.Split(line, ":")
+    if len(fields) < 4 {
+      continue
+    }
+    gid, err := strconv.Atoi(fields[2])
+    if err != nil {
+      continue
+    }
+    var members []string
+    if fields[3] != "" {
+      members = strings.Split(fields[3], ",")
+    }
+    groups = append(groups, Group{Name: fields[0], GID: gid, Members: members})
+  }
+  return groups, scanner.Err()
+}
+
+func formatUser(u User) string {
+  return fmt.Sprintf("%s:x:%d:%d:%s:%s:%s", u.Name, u.UID, u.GID, u.Gecos, u.Home, u.Shell)
+}
+
+func formatGroup(g Group) string {
+  return fmt.Sprintf("%s:x:%d:%s", g.Name, g.GID, strings.Join(g.Members, ","))
+}
+
+// appendLine adds line to path via write-tmp/fsync/rename so a concurrent
+// reader never observes a half-written file.
+func appendLine(path, line string) error {
+  existing, err := os.ReadFile(path)
+  if err != nil {
+    return fmt.Errorf("userdb: read %s: %w", path, err)
+  }
+  tmp := path + ".tmp"
+  out, err := os.OpenFile(tmp, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0o644)
+  if err != nil {
+    return fmt.Errorf("userdb: create %s: %w", tmp, err)
+  }
+  if _, err := out.Write(existing); err != nil {
+    out.Close()
+    return err
+  }
+  if len(existing) > 0 && existing[len(existing)-1] != '\n' {
+    if _, err := out.WriteString("\n"); err != nil {
+      out.Close()
+      return err
+    }
+  }
+  if _, err := out.WriteString(line + "\n"); err != nil {
+    out.Close()
+    return err
+  }
+  if err := out.Sync(); err != nil {
+    out.Close()
+    return err
+  }
+  if err := out.Close(); err != nil {
+    return err
+  }
+  return os.Rename(tmp, path)
+}
+
+// withLock serializes concurrent provisioning against the same passwd/group
+// file with a flock on a sibling ".lock" file.
+func withLock(path string, fn func() error) error {
+  lockPath := path + ".lock"
+  lockFile, err := os.OpenFile(lockPath, os.O_CREATE|os.O_RDWR, 0o644)
+  if err != nil {
+    return fmt.Errorf("userdb: open lock %s: %w", lockPath, err)
+  }
+  defer lockFile.Close()
+
+  if err := unix.Flock(int(lockFile.Fd()), unix.LOCK_EX); err != nil {
+    return fmt.Errorf("userdb: flock %s: %w", lockPath, err)
+  }
+  defer unix.Flock(int(lockFile.Fd()), unix.LOCK_UN)
+
+  return fn()
+}
@@ -0,0 +1,142 @@
+package main
+
+import (
+  "bytes"
+  "crypto/sha256"
+  "embed"
+  "encoding/hex"
+  "encoding/json"
+  "fmt"
+  "os"
+  "path/filepath"
+  "text/template"
+)
+
+//go:embed assets/*
+var dotfileAssets embed.FS
+
+const dotfileSumsName = "dotfiles.sums.json"
+
+// dotfileSpec maps an embedded template to the dotfile it renders into a
+// workspace home directory.
+type dotfileSpec struct {
+  template string
+  dest     string
+}
+
+var dotfileSpecs = []dotfileSpec{
+  {template: "assets/bashrc.tmpl", dest: ".bashrc"},
+  {template: "assets/profile.tmpl", dest: ".profile"},
+  {template: "assets/bash_aliases.tmpl", dest: ".bash_aliases"},
+  {template: "assets/gitconfig.tmpl", dest: ".gitconfig"},
+  {template: "assets/gitignore_global.tmpl", dest: ".gitignore_global"},
+}
+
+type dotfileTemplateData struct {
+  WorkspaceID string
+  HomeDir     string
+}
+
+// renderDotfiles writes the embedded dotfile templates into homeDir. A
+// dotfile is (re)written when it is missing or its on-disk sha256 still
+// matches the version vibe80-root last shipped (tracked in
+// metadata/dotfiles.sums.json); anything else is a user edit and is left
+// alone unless force is set.
+func renderDotfiles(homeDir, metadataDir, workspaceID string, uid, gid int, force bool) error {
+  sumsPath := filepath.Join(metadataDir, dotfileSumsName)
+  sums, err := loadDotfileSums(sumsPath)
+  if err != nil {
+    return fmt.Errorf("load dotfile sums: %w", err)
+  }
+
+  data := dotfileTemplateData{WorkspaceID: workspaceID, HomeDir: homeDir}
+  changed := false
+
+  for _, spec := range dotfileSpecs {
+    rendered, err := renderTemplate(spec.template, data)
+    if err != nil {
+      return fmt.Errorf("render %s: %w", spec.template, err)
+    }
+    newSum := sha256Hex(rendered)
+    destPath := filepath.Join(homeDir, spec.dest)
+
+    if !force {
+      existing, readErr := os.ReadFile(destPath)
+      if readErr == nil {
+        if prevSum, tracked := sums[spec.dest]; !tracked || sha256Hex(existing) != prevSum {
+          // Either never shipped by us, or a user has edited it since: leave it.
+          continue
+        }
+      } else if !os.IsNotExist(readErr) {
+        return fmt.Errorf("stat %s: %w", destPath, readErr)
+      }
+    }
+
+    if err := writeFileAtomic(destPath, rendered, 0o640, uid, gid); err != nil {
+      return fmt.Errorf("write %s: %w", destPath, err)
+    }
+    sums[spec.dest] = newSum
+    changed = true
+  }
+
+  if !changed {
+    return nil
+  }
+  return saveDotfileSums(sumsPath, sums, uid, gid)
+}
+
+func renderTemplate(name string, data dotfileTemplateData) ([]byte, error) {
+  raw, err := dotfileAssets.ReadFile(name)
+  if err != nil {
+    return nil, err
+  }
+  tmpl, err := template.New(name).Parse(string(raw))
+  if err != nil {
+    return nil, err
+  }
+  var buf bytes.Buffer
+  if err := tmpl.Execute(&buf, data); err != nil {
+    return nil, err
+  }
+  return buf.Bytes(), nil
+}
+
+func sha256Hex(content []byte) string {
+  sum := sha256.Sum256(content)
+  return hex.EncodeToString(sum[:])
+}
+
+func writeFileAtomic(path string, content []byte, mode os.FileMode, uid, gid int) error {
+  tmp := path + ".tmp"
+  if err := os.WriteFile(tmp, content, mode); err != nil {
+    return err
+  }
+  if err := os.Chown(tmp, uid, gid); err != nil {
+    os.Remove(tmp)
+    return err
+  }
+  return os.Rename(tmp, path)
+}
+
+func loadDotfileSums(path string) (map[string]string, error) {
+  raw, err := os.ReadFile(path)
+  if err != nil {
+    if os.IsNotExist(err) {
+      return map[string]string{}, nil
+    }
+    return nil, err
+  }
+  sums := map[string]string{}
+  if err := json.Unmarshal(raw, &sums); err != nil {
+    return nil, err
+  }
+  return sums, nil
+}
+
+func saveDotfileSums(path string, sums map[string]string, uid, gid int) error {
+  raw, err := json.MarshalIndent(sums, "", "  ")
+  if err != nil {
+    return err
+  }
+  return writeFileAtomic(path, raw, 0o640, uid, gid)
+}
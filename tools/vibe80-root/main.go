@@ -5,11 +5,12 @@ import (
   "errors"
   "fmt"
   "os"
-  "os/exec"
   "path/filepath"
   "regexp"
   "strconv"
-  "strings"
+
+  "vibe80/vibe80/internal/safepath"
+  "vibe80/vibe80/internal/userdb"
 )
 
 const (
@@ -28,6 +29,31 @@ func main() {
   case "create-workspace":
     workspaceID := parseFlagValue("--workspace-id")
     ensureWorkspace(workspaceID)
+  case "dump-init-files":
+    workspaceID := parseFlagValue("--workspace-id")
+    dumpInitFiles(workspaceID)
+  case "prune-sessions":
+    workspaceID := parseFlagValue("--workspace-id")
+    keep, err := strconv.Atoi(parseFlagValueOptional("--keep", "500"))
+    if err != nil || keep < 0 {
+      fail("invalid --keep value")
+    }
+    pruneSessions(workspaceID, keep)
+  case "tail-sessions":
+    workspaceID := parseFlagValue("--workspace-id")
+    tailSessions(workspaceID)
+  case "overlay":
+    if len(os.Args) < 4 {
+      fail("usage: overlay <commit|discard> <workspaceID>")
+    }
+    switch os.Args[2] {
+    case "commit":
+      overlayCommit(os.Args[3])
+    case "discard":
+      overlayDiscard(os.Args[3])
+    default:
+      fail("unknown overlay subcommand")
+    }
   default:
     fail("unknown command")
   }
@@ -43,11 +69,25 @@ func parseFlagValue(flag string) string {
   return ""
 }
 
-func ensureWorkspace(workspaceID string) {
-  if !workspaceIDPattern.MatchString(workspaceID) {
-    fail("invalid workspace-id")
+func parseFlagValueOptional(flag, defaultValue string) string {
+  for i := 2; i < len(os.Args); i++ {
+    if os.Args[i] == flag && i+1 < len(os.Args) {
+      return os.Args[i+1]
+    }
   }
+  return defaultValue
+}
+
+// workspacePaths holds the directories derived from a workspace ID that
+// every subcommand needs.
+type workspacePaths struct {
+  homeDir     string
+  rootDir     string
+  metadataDir string
+  sessionsDir string
+}
 
+func resolveWorkspacePaths(workspaceID string) workspacePaths {
   homeBase := os.Getenv("WORKSPACE_HOME_BASE")
   if homeBase == "" {
     homeBase = "/home"
@@ -57,10 +97,22 @@ func ensureWorkspace(workspaceID string) {
     workspaceRootBase = "/workspaces"
   }
 
-  homeDir := filepath.Join(homeBase, workspaceID)
   rootDir := filepath.Join(workspaceRootBase, workspaceID)
-  metadataDir := filepath.Join(rootDir, workspaceMetadataDirName)
-  sessionsDir := filepath.Join(rootDir, workspaceSessionsDirName)
+  return workspacePaths{
+    homeDir:     filepath.Join(homeBase, workspaceID),
+    rootDir:     rootDir,
+    metadataDir: filepath.Join(rootDir, workspaceMetadataDirName),
+    sessionsDir: filepath.Join(rootDir, workspaceSessionsDirName),
+  }
+}
+
+func ensureWorkspace(workspaceID string) {
+  if !workspaceIDPattern.MatchString(workspaceID) {
+    fail("invalid workspace-id")
+  }
+
+  paths := resolveWorkspacePaths(workspaceID)
+  homeDir, rootDir, metadataDir, sessionsDir := paths.homeDir, paths.rootDir, paths.metadataDir, paths.sessionsDir
 
   desiredUID, desiredGID := readWorkspaceUIDGID(metadataDir)
 
@@ -76,65 +128,77 @@ func ensureWorkspace(workspaceID string) {
   if err := ensureDir(homeDir, 02750, uid, gid); err != nil {
     fail(err.Error())
   }
-  if err := ensureFile(filepath.Join(homeDir, ".profile"), 0640, uid, gid); err != nil {
+  if err := ensureDir(rootDir, 02750, uid, gid); err != nil {
     fail(err.Error())
   }
-  if err := ensureFile(filepath.Join(homeDir, ".bashrc"), 0640, uid, gid); err != nil {
+  if err := ensureDir(metadataDir, 02750, uid, gid); err != nil {
     fail(err.Error())
   }
-  if err := ensureDir(rootDir, 02750, uid, gid); err != nil {
+  if err := ensureDir(sessionsDir, 02750, uid, gid); err != nil {
     fail(err.Error())
   }
-  if err := ensureDir(metadataDir, 02750, uid, gid); err != nil {
+  if err := renderDotfiles(homeDir, metadataDir, workspaceID, uid, gid, false); err != nil {
     fail(err.Error())
   }
-  if err := ensureDir(sessionsDir, 02750, uid, gid); err != nil {
+  ensureOwnership(metadataDir, filepath.Join(metadataDir, "workspace.json"), uid, gid)
+  ensureOwnership(metadataDir, filepath.Join(metadataDir, "workspace.secret"), uid, gid)
+}
+
+// dumpInitFiles force-overwrites a workspace's dotfiles with the versions
+// currently embedded in this binary, regardless of whether the user has
+// edited them.
+func dumpInitFiles(workspaceID string) {
+  if !workspaceIDPattern.MatchString(workspaceID) {
+    fail("invalid workspace-id")
+  }
+
+  paths := resolveWorkspacePaths(workspaceID)
+
+  uid, gid, err := lookupIDs(workspaceID)
+  if err != nil {
+    fail(err.Error())
+  }
+  if err := renderDotfiles(paths.homeDir, paths.metadataDir, workspaceID, uid, gid, true); err != nil {
     fail(err.Error())
   }
-  ensureOwnership(filepath.Join(metadataDir, "workspace.json"), uid, gid)
-  ensureOwnership(filepath.Join(metadataDir, "workspace.secret"), uid, gid)
 }
 
 func ensureUser(workspaceID, homeDir string, uid, gid int) error {
-  _, err := exec.Command("id", "-u", workspaceID).Output()
-  if err == nil {
+  if _, err := userdb.LookupUser(workspaceID); err == nil {
     return nil
   }
-  args := []string{"-m", "-d", homeDir, "-s", "/bin/bash"}
-  if uid >= 0 {
-    args = append(args, "-u", strconv.Itoa(uid))
-  }
-  if gid >= 0 {
-    ensureGroup(workspaceID, gid)
-    args = append(args, "-g", strconv.Itoa(gid))
+  if gid < 0 {
+    allocated, err := userdb.AllocateGID(userdb.DefaultMinUID, userdb.DefaultMaxUID)
+    if err != nil {
+      return fmt.Errorf("allocate gid: %w", err)
+    }
+    gid = allocated
   }
-  args = append(args, workspaceID)
-  cmd := exec.Command("useradd", args...)
-  output, err := cmd.CombinedOutput()
-  if err != nil {
-    return fmt.Errorf("useradd failed: %s", strings.TrimSpace(string(output)))
+  if err := ensureGroup(workspaceID, gid); err != nil {
+    return fmt.Errorf("ensure group: %w", err)
   }
-  return nil
+  if uid < 0 {
+    allocated, err := userdb.AllocateUID(userdb.DefaultMinUID, userdb.DefaultMaxUID)
+    if err != nil {
+      return fmt.Errorf("allocate uid: %w", err)
+    }
+    uid = allocated
+  }
+  return userdb.AddUser(userdb.User{
+    Name:  workspaceID,
+    UID:   uid,
+    GID:   gid,
+    Home:  homeDir,
+    Shell: "/bin/bash",
+  })
 }
 
 func lookupIDs(workspaceID string) (int, int, error) {
-  uidRaw, err := exec.Command("id", "-u", workspaceID).Output()
-  if err != nil {
-    return 0, 0, errors.New("unable to resolve uid")
-  }
-  gidRaw, err := exec.Command("id", "-g", workspaceID).Output()
+  user, err := userdb.LookupUser(workspaceID)
   if err != nil {
-    return 0, 0, errors.New("unable to resolve gid")
+    return 0, 0, errors.New("unable to resolve workspace ids")
   }
-  uid, err := strconv.Atoi(strings.TrimSpace(string(uidRaw)))
-  if err != nil {
-    return 0, 0, errors.New("invalid uid")
-  }
-  gid, err := strconv.Atoi(strings.TrimSpace(string(gidRaw)))
-  if err != nil {
-    return 0, 0, errors.New("invalid gid")
-  }
-  return uid, gid, nil
+  return user.UID, user.GID, nil
 }
 
 func ensureDir(path string, mode os.FileMode, uid, gid int) error {
@@ -150,35 +214,23 @@ func ensureDir(path string, mode os.FileMode, uid, gid int) error {
   return nil
 }
 
-func ensureFile(path string, mode os.FileMode, uid, gid int) error {
-  file, err := os.OpenFile(path, os.O_RDONLY|os.O_CREATE, mode)
+// ensureOwnership chowns path beneath anchorDir via a SafePath so a symlink
+// raced into place between the existence check and the chown cannot redirect
+// the chown outside the workspace.
+func ensureOwnership(anchorDir, path string, uid, gid int) {
+  safe, err := safepath.ResolveAbs(anchorDir, path)
   if err != nil {
-    return fmt.Errorf("touch failed: %s", err)
-  }
-  if err := file.Close(); err != nil {
-    return fmt.Errorf("close failed: %s", err)
-  }
-  if err := os.Chown(path, uid, gid); err != nil {
-    return fmt.Errorf("chown failed: %s", err)
-  }
-  if err := os.Chmod(path, mode); err != nil {
-    return fmt.Errorf("chmod failed: %s", err)
-  }
-  return nil
-}
-
-func ensureOwnership(path string, uid, gid int) {
-  if _, err := os.Stat(path); err != nil {
     return
   }
-  _ = os.Chown(path, uid, gid)
+  defer safe.Close()
+  _ = os.Chown(safe.ProcPath(), uid, gid)
 }
 
-func ensureGroup(name string, gid int) {
-  if _, err := exec.Command("getent", "group", strconv.Itoa(gid)).Output(); err == nil {
-    return
+func ensureGroup(name string, gid int) error {
+  if _, err := userdb.LookupGroupByGID(gid); err == nil {
+    return nil
   }
-  _ = exec.Command("groupadd", "-g", strconv.Itoa(gid), name).Run()
+  return userdb.AddGroup(userdb.Group{Name: name, GID: gid})
 }
 
 func readWorkspaceUIDGID(metadataDir string) (int, int) {
@@ -0,0 +1,51 @@
+package main
+
+import (
+  "fmt"
+  "os"
+  "os/exec"
+
+  "vibe80/vibe80/internal/overlay"
+)
+
+// overlayCommit merges a persistent overlay's upperdir back into a
+// workspace's real tree (rsync keeps ownership/permissions and copies only
+// what's changed) and removes the overlay directory once that succeeds, so
+// a workspace can only ever have one pending overlay at a time.
+func overlayCommit(workspaceID string) {
+  if !workspaceIDPattern.MatchString(workspaceID) {
+    fail("invalid workspace-id")
+  }
+  paths := resolveWorkspacePaths(workspaceID)
+  overlayDir := overlay.Dir(paths.rootDir)
+  upperDir := overlayDir + "/upper"
+
+  if _, err := os.Stat(upperDir); err != nil {
+    fail(fmt.Sprintf("no pending overlay for %s: %s", workspaceID, err))
+  }
+
+  cmd := exec.Command("rsync", "-a", upperDir+"/", paths.rootDir+"/")
+  cmd.Stdout = os.Stdout
+  cmd.Stderr = os.Stderr
+  if err := cmd.Run(); err != nil {
+    fail(fmt.Sprintf("rsync upper into %s: %s", paths.rootDir, err))
+  }
+
+  if err := os.RemoveAll(overlayDir); err != nil {
+    fail(fmt.Sprintf("remove overlay dir: %s", err))
+  }
+}
+
+// overlayDiscard throws away a persistent overlay's upperdir/workdir
+// without touching the workspace's real tree at all.
+func overlayDiscard(workspaceID string) {
+  if !workspaceIDPattern.MatchString(workspaceID) {
+    fail("invalid workspace-id")
+  }
+  paths := resolveWorkspacePaths(workspaceID)
+  overlayDir := overlay.Dir(paths.rootDir)
+
+  if err := os.RemoveAll(overlayDir); err != nil {
+    fail(fmt.Sprintf("remove overlay dir: %s", err))
+  }
+}
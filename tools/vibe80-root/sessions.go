@@ -0,0 +1,92 @@
+package main
+
+import (
+  "encoding/json"
+  "fmt"
+  "os"
+  "path/filepath"
+  "sort"
+  "strings"
+)
+
+// pruneSessions deletes the oldest session journal files under a
+// workspace's sessions/ directory, keeping at most `keep` of them. ULID
+// filenames sort lexically in creation order, so the ones to drop are
+// simply the lowest-sorting prefix. Each journal file has a same-named
+// sibling directory holding that invocation's materialized secrets (if it
+// had any); vibe80-run-as removes the secrets/ directory inside it once its
+// command exits, and a pruned session's directory itself is removed here,
+// along with any secrets left in it if that cleanup never ran (e.g.
+// vibe80-run-as was killed first).
+func pruneSessions(workspaceID string, keep int) {
+  if !workspaceIDPattern.MatchString(workspaceID) {
+    fail("invalid workspace-id")
+  }
+  paths := resolveWorkspacePaths(workspaceID)
+
+  names, err := sessionFileNames(paths.sessionsDir)
+  if err != nil {
+    fail(err.Error())
+  }
+  if len(names) <= keep {
+    return
+  }
+  for _, name := range names[:len(names)-keep] {
+    if err := os.Remove(filepath.Join(paths.sessionsDir, name)); err != nil {
+      fail(err.Error())
+    }
+    id := strings.TrimSuffix(name, ".json")
+    if err := os.RemoveAll(filepath.Join(paths.sessionsDir, id)); err != nil {
+      fmt.Fprintln(os.Stderr, "warning: failed to remove secrets dir for session", id, err)
+    }
+  }
+}
+
+// tailSessions streams every session journal entry for a workspace to
+// stdout as newline-delimited JSON, oldest first, for consumption by
+// external log shippers.
+func tailSessions(workspaceID string) {
+  if !workspaceIDPattern.MatchString(workspaceID) {
+    fail("invalid workspace-id")
+  }
+  paths := resolveWorkspacePaths(workspaceID)
+
+  names, err := sessionFileNames(paths.sessionsDir)
+  if err != nil {
+    fail(err.Error())
+  }
+
+  enc := json.NewEncoder(os.Stdout)
+  for _, name := range names {
+    raw, err := os.ReadFile(filepath.Join(paths.sessionsDir, name))
+    if err != nil {
+      continue
+    }
+    var rec json.RawMessage
+    if err := json.Unmarshal(raw, &rec); err != nil {
+      continue
+    }
+    if err := enc.Encode(rec); err != nil {
+      fail(err.Error())
+    }
+  }
+}
+
+func sessionFileNames(sessionsDir string) ([]string, error) {
+  entries, err := os.ReadDir(sessionsDir)
+  if err != nil {
+    if os.IsNotExist(err) {
+      return nil, nil
+    }
+    return nil, err
+  }
+  names := make([]string, 0, len(entries))
+  for _, entry := range entries {
+    if entry.IsDir() || !strings.HasSuffix(entry.Name(), ".json") {
+      continue
+    }
+    names = append(names, entry.Name())
+  }
+  sort.Strings(names)
+  return names, nil
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+  "bytes"
+  "encoding/json"
+  "fmt"
+  "os"
+  "os/exec"
+
+  "vibe80/vibe80/internal/launchspec"
+)
+
+// hookState is the state document hooks receive on stdin, matching the OCI
+// runtime-spec hook contract (the state object's "pid" field).
+type hookState struct {
+  Pid int `json:"pid"`
+}
+
+// allowedHookCommands is deliberately narrower than allowedCommands: hooks
+// run unsandboxed as root in the parent (no Credential, no landlock, no
+// seccomp — see runHooks), so the allowlist excludes every shell/interpreter
+// entry from allowedCommands (/bin/bash, /bin/sh, /usr/bin/env) that would
+// let a --spec document's "args" smuggle arbitrary root code past a path
+// check on the interpreter itself.
+var allowedHookCommands = map[string]struct{}{
+  "/usr/bin/git":        {},
+  "/usr/bin/ssh-keyscan": {},
+  "/bin/mkdir":          {},
+  "/bin/chmod":          {},
+  "/bin/cat":            {},
+  "/bin/rm":             {},
+  "/bin/ls":             {},
+  "/usr/bin/stat":       {},
+  "/usr/bin/head":       {},
+  "/usr/bin/find":       {},
+  "/usr/bin/tee":        {},
+}
+
+// validateHooks checks every prestart/poststop hook's Path against
+// allowedHookCommands. Hooks are a privileged, operator-authored part of a
+// --spec document (matching runc/OCI's own trust model for hooks), so this
+// isn't a sandbox in itself — it just keeps a hook path from being one of
+// the shell/env interpreters whose whole job is running arbitrary code.
+func validateHooks(hooks *launchspec.Hooks) error {
+  if hooks == nil {
+    return nil
+  }
+  for _, hook := range append(append([]launchspec.HookEntry{}, hooks.Prestart...), hooks.Poststop...) {
+    if _, ok := allowedHookCommands[hook.Path]; !ok {
+      return fmt.Errorf("launchspec: disallowed hook path %q", hook.Path)
+    }
+  }
+  return nil
+}
+
+// runHooks executes each hook in order, feeding it pid as the OCI-style
+// state document on stdin, with its stdout/stderr passed through so
+// operators can see hook output. It stops at and returns the first failing
+// hook.
+func runHooks(hooks []launchspec.HookEntry, pid int) error {
+  state, err := json.Marshal(hookState{Pid: pid})
+  if err != nil {
+    return fmt.Errorf("hooks: encode state: %w", err)
+  }
+  for _, hook := range hooks {
+    cmd := exec.Command(hook.Path, hook.Args...)
+    cmd.Stdin = bytes.NewReader(state)
+    cmd.Stdout = os.Stdout
+    cmd.Stderr = os.Stderr
+    if err := cmd.Run(); err != nil {
+      return fmt.Errorf("hooks: %s: %w", hook.Path, err)
+    }
+  }
+  return nil
+}
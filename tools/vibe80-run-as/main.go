@@ -12,15 +12,30 @@ import (
   "strconv"
   "strings"
   "syscall"
+  "time"
 
   landlock "github.com/landlock-lsm/go-landlock/landlock"
-  seccomp "github.com/seccomp/libseccomp-golang"
+
+  "vibe80/vibe80/internal/caps"
+  "vibe80/vibe80/internal/cgroup"
+  "vibe80/vibe80/internal/launchspec"
+  "vibe80/vibe80/internal/overlay"
+  "vibe80/vibe80/internal/safepath"
+  "vibe80/vibe80/internal/sandbox"
+  "vibe80/vibe80/internal/secret"
+  "vibe80/vibe80/internal/session"
+  "vibe80/vibe80/internal/userdb"
 )
 
 var workspaceIDPattern = regexp.MustCompile(`^w[0-9a-f]{24}$`)
 const workspaceMetadataDirName = "metadata"
 const workspaceConfigName = "workspace.json"
 
+// oomExitCode is reported instead of the child's real exit status when the
+// kernel OOM-killed something inside its cgroup, so callers can tell that
+// case apart from an ordinary nonzero exit.
+const oomExitCode = 137
+
 var allowedCommands = map[string]struct{}{
   "/usr/bin/git":        {},
   "/usr/bin/ssh-keyscan": {},
@@ -52,7 +67,20 @@ var allowedEnvKeys = map[string]struct{}{
   "TMPDIR":             {},
 }
 
+// allowedSecretKeys is deliberately separate from allowedEnvKeys: these
+// values never flow through --env (argv, ps output, env dumps) and are
+// only ever accepted over --secret-fd/--secret-file.
+var allowedSecretKeys = map[string]struct{}{
+  "GIT_ASKPASS_TOKEN": {},
+  "SSH_PRIVATE_KEY":   {},
+}
+
 func main() {
+  if len(os.Args) > 1 && os.Args[1] == stage2Flag {
+    runStage2()
+    return
+  }
+
   args := os.Args[1:]
   workspaceID := ""
   cwd := ""
@@ -65,6 +93,18 @@ func main() {
   allowRWFiles := []string{}
   netMode := ""
   seccompMode := ""
+  noSandbox := false
+  secretFD := -1
+  secretFile := ""
+  cgroupMemoryMax := ""
+  cgroupPidsMax := ""
+  cgroupCPUMax := ""
+  cgroupIOMax := ""
+  capAdd := ""
+  seccompProfile := ""
+  ttyFlag := false
+  overlayFlag := ""
+  specPath := ""
 
   for i := 0; i < len(args); i++ {
     arg := args[i]
@@ -123,6 +163,74 @@ func main() {
       }
       seccompMode = strings.TrimSpace(args[i+1])
       i++
+    case "--no-sandbox":
+      noSandbox = true
+    case "--tty":
+      ttyFlag = true
+    case "--secret-fd":
+      if i+1 >= len(args) {
+        fail("missing secret-fd value")
+      }
+      fd, err := strconv.Atoi(args[i+1])
+      if err != nil {
+        fail("invalid secret-fd value")
+      }
+      secretFD = fd
+      i++
+    case "--secret-file":
+      if i+1 >= len(args) {
+        fail("missing secret-file value")
+      }
+      secretFile = args[i+1]
+      i++
+    case "--cgroup-memory-max":
+      if i+1 >= len(args) {
+        fail("missing cgroup-memory-max value")
+      }
+      cgroupMemoryMax = args[i+1]
+      i++
+    case "--cgroup-pids-max":
+      if i+1 >= len(args) {
+        fail("missing cgroup-pids-max value")
+      }
+      cgroupPidsMax = args[i+1]
+      i++
+    case "--cgroup-cpu-max":
+      if i+1 >= len(args) {
+        fail("missing cgroup-cpu-max value")
+      }
+      cgroupCPUMax = args[i+1]
+      i++
+    case "--cgroup-io-max":
+      if i+1 >= len(args) {
+        fail("missing cgroup-io-max value")
+      }
+      cgroupIOMax = args[i+1]
+      i++
+    case "--cap-add":
+      if i+1 >= len(args) {
+        fail("missing cap-add value")
+      }
+      capAdd = args[i+1]
+      i++
+    case "--seccomp-profile":
+      if i+1 >= len(args) {
+        fail("missing seccomp-profile value")
+      }
+      seccompProfile = strings.TrimSpace(args[i+1])
+      i++
+    case "--overlay":
+      if i+1 >= len(args) {
+        fail("missing overlay value")
+      }
+      overlayFlag = strings.TrimSpace(args[i+1])
+      i++
+    case "--spec":
+      if i+1 >= len(args) {
+        fail("missing spec value")
+      }
+      specPath = args[i+1]
+      i++
     case "--":
       if i+1 >= len(args) {
         fail("missing command")
@@ -135,6 +243,22 @@ func main() {
     }
   }
 
+  var hooks *launchspec.Hooks
+  if specPath != "" {
+    spec, err := launchspec.Load(specPath)
+    if err != nil {
+      fail(err.Error())
+    }
+    hooks = spec.Hooks
+    if err := validateHooks(hooks); err != nil {
+      fail(err.Error())
+    }
+    mergeSpec(spec, &workspaceID, &cwd, &command, &commandArgs, &envPairs,
+      &allowRO, &allowRW, &allowROFiles, &allowRWFiles,
+      &netMode, &seccompProfile, &capAdd, &ttyFlag,
+      &cgroupMemoryMax, &cgroupPidsMax, &cgroupCPUMax, &cgroupIOMax)
+  }
+
   if !workspaceIDPattern.MatchString(workspaceID) {
     fail("invalid workspace-id")
   }
@@ -164,20 +288,34 @@ func main() {
   }
   homeDir := filepath.Join(homeBase, workspaceID)
   workspaceRootDir := filepath.Join(workspaceRootBase, workspaceID)
+  sessionsDir := filepath.Join(workspaceRootDir, "sessions")
 
+  sessionID, err := session.NewID()
+  if err != nil {
+    fail("session id: " + err.Error())
+  }
+
+  var cwdForRecord string
+  var safeCwd *safepath.SafePath
   if cwd != "" {
     resolvedCwd, err := filepath.Abs(cwd)
     if err != nil {
       fail("invalid cwd")
     }
-    if !strings.HasPrefix(resolvedCwd, homeDir+string(os.PathSeparator)) &&
-      resolvedCwd != homeDir &&
-      !strings.HasPrefix(resolvedCwd, workspaceRootDir+string(os.PathSeparator)) &&
-      resolvedCwd != workspaceRootDir {
+    anchor := homeDir
+    if strings.HasPrefix(resolvedCwd, workspaceRootDir+string(os.PathSeparator)) || resolvedCwd == workspaceRootDir {
+      anchor = workspaceRootDir
+    } else if !strings.HasPrefix(resolvedCwd, homeDir+string(os.PathSeparator)) && resolvedCwd != homeDir {
       fail("cwd outside workspace")
     }
-    cwd = resolvedCwd
+    safeCwd, err = safepath.ResolveAbs(anchor, resolvedCwd)
+    if err != nil {
+      fail("cwd outside workspace: " + err.Error())
+    }
+    cwdForRecord = resolvedCwd
+    cwd = safeCwd.ProcPath()
   } else {
+    cwdForRecord = homeDir
     cwd = homeDir
   }
 
@@ -188,32 +326,131 @@ func main() {
     "PATH=/usr/local/bin:/usr/bin:/bin",
   }
 
+  tmpDir := ""
   for _, pair := range envPairs {
-    key := strings.SplitN(pair, "=", 2)[0]
+    parts := strings.SplitN(pair, "=", 2)
+    key := parts[0]
     if _, ok := allowedEnvKeys[key]; !ok {
       fail("disallowed env key: " + key)
     }
+    if key == "TMPDIR" && len(parts) == 2 {
+      tmpDir = parts[1]
+    }
     env = append(env, pair)
   }
 
-  cmd := exec.Command(resolved, commandArgs...)
+  var secretPairs []secret.Pair
+  var secretsDir string
+  if secretFD >= 0 || secretFile != "" {
+    var err error
+    secretPairs, err = readSecrets(secretFD, secretFile)
+    if err != nil {
+      fail("secret: " + err.Error())
+    }
+    if err := secret.Validate(secretPairs, allowedSecretKeys); err != nil {
+      secret.Wipe(secretPairs)
+      fail(err.Error())
+    }
+    secretsDir = filepath.Join(sessionsDir, sessionID, "secrets")
+    secretPaths, err := secret.Materialize(secretsDir, int(uid), int(gid), secretPairs)
+    if err != nil {
+      secret.Wipe(secretPairs)
+      fail("secret: " + err.Error())
+    }
+    if keyPath, ok := secretPaths["SSH_PRIVATE_KEY"]; ok {
+      env = append(env, "GIT_SSH_COMMAND=ssh -i "+keyPath+" -o IdentitiesOnly=yes -o StrictHostKeyChecking=accept-new")
+    }
+    if tokenPath, ok := secretPaths["GIT_ASKPASS_TOKEN"]; ok {
+      env = append(env, "GIT_ASKPASS_TOKEN_FILE="+tokenPath)
+    }
+  }
+
+  keepCaps, err := caps.Parse(capAdd)
+  if err != nil {
+    fail(err.Error())
+  }
+  resolvedSeccompProfile, err := resolveSeccompProfile(seccompMode, seccompProfile, netMode)
+  if err != nil {
+    fail(err.Error())
+  }
+  var overlaySpec overlay.Spec
+  if overlayFlag != "" {
+    overlaySpec, err = overlay.ParseFlag(overlayFlag)
+    if err != nil {
+      fail(err.Error())
+    }
+  }
+
+  allowRO = uniqueStrings(allowRO)
+  allowRW = uniqueStrings(allowRW)
+  allowROFiles = uniqueStrings(allowROFiles)
+  allowRWFiles = uniqueStrings(allowRWFiles)
+  if len(allowRO) > 0 || len(allowRW) > 0 || len(allowROFiles) > 0 || len(allowRWFiles) > 0 {
+    allowRO = ensureBaseReadPaths(allowRO, resolved)
+  }
+  if noSandbox && os.Getenv("VIBE80_ALLOW_NO_SANDBOX") != "1" {
+    fail("--no-sandbox requires VIBE80_ALLOW_NO_SANDBOX=1 in the environment")
+  }
+
+  selfPath, err := os.Executable()
+  if err != nil {
+    fail("unable to resolve own executable: " + err.Error())
+  }
+  parentSock, childSock, err := socketpair()
+  if err != nil {
+    fail(err.Error())
+  }
+
+  // The stage2 child is what actually applies prctl/capset/landlock/seccomp
+  // and execve's the resolved command; this process stays unsandboxed so it
+  // can still reach /sys/fs/cgroup and the session journal after the child
+  // execs (see runStage2 in stage2.go for the rest of the trampoline).
+  cmd := exec.Command(selfPath, stage2Flag)
   cmd.Env = env
   cmd.Dir = cwd
-  cmd.Stdin = os.Stdin
-  cmd.Stdout = os.Stdout
-  cmd.Stderr = os.Stderr
-  isTty := false
+  cmd.ExtraFiles = []*os.File{childSock}
+
+  stdinIsTTY := false
   if info, err := os.Stdin.Stat(); err == nil {
-    isTty = (info.Mode() & os.ModeCharDevice) != 0
+    stdinIsTTY = (info.Mode() & os.ModeCharDevice) != 0
   }
-  cmd.SysProcAttr = &syscall.SysProcAttr{
-    Setpgid: !isTty,
-    Credential: &syscall.Credential{Uid: uid, Gid: gid},
+  useTTY := ttyFlag || stdinIsTTY
+
+  var ttySess *ttySession
+  if useTTY {
+    ttySess, err = setupTTY(cmd)
+    if err != nil {
+      fail("tty: " + err.Error())
+    }
+    // ttySess.Close (restoring the operator's real terminal out of raw
+    // mode) is called explicitly at the single exit point below rather
+    // than deferred, since every path out of main ends in os.Exit, which
+    // does not run deferred functions.
+    // Setctty makes the child (the stage2 process, and whatever it execs
+    // into) the session leader of its own pty session instead of inheriting
+    // ours, so Ctrl-C/Ctrl-\ reach it the way they would a normal shell job
+    // instead of being forwarded through the signal goroutine below.
+    // uid/gid stay root here: the stage2 child needs its privileges intact
+    // to drop capabilities and mount the overlay before it switches to the
+    // workspace's uid/gid itself (see switchToWorkspaceUser in stage2.go).
+    cmd.SysProcAttr = &syscall.SysProcAttr{
+      Setsid: true,
+      Setctty: true,
+    }
+  } else {
+    cmd.Stdin = os.Stdin
+    cmd.Stdout = os.Stdout
+    cmd.Stderr = os.Stderr
+    cmd.SysProcAttr = &syscall.SysProcAttr{
+      Setpgid: true,
+    }
   }
 
   sigCh := make(chan os.Signal, 1)
   signal.Notify(sigCh, syscall.SIGTERM, syscall.SIGINT)
-  defer signal.Stop(sigCh)
+  // Stopped explicitly at the single exit point below, alongside the rest
+  // of this function's cleanup, rather than deferred: main always exits
+  // through os.Exit, which skips deferred functions entirely.
 
   go func() {
     for sig := range sigCh {
@@ -229,28 +466,186 @@ func main() {
     }
   }()
 
-  allowRO = uniqueStrings(allowRO)
-  allowRW = uniqueStrings(allowRW)
-  allowROFiles = uniqueStrings(allowROFiles)
-  allowRWFiles = uniqueStrings(allowRWFiles)
-  if len(allowRO) > 0 || len(allowRW) > 0 || len(allowROFiles) > 0 || len(allowRWFiles) > 0 {
-    allowRO = ensureBaseReadPaths(allowRO, resolved)
+  wantCgroup := cgroupMemoryMax != "" || cgroupPidsMax != "" || cgroupCPUMax != "" || cgroupIOMax != ""
+
+  // The cgroup has to exist, with its limits already written, before
+  // cmd.Start() so the child can be born into it via CLONE_INTO_CGROUP
+  // (cmd.SysProcAttr.CgroupFD below) instead of joining via a cgroup.procs
+  // write afterward, which would leave it briefly unconstrained.
+  var cg *cgroup.Cgroup
+  var cgDirFD *os.File
+  if wantCgroup {
+    cg, err = cgroup.New(workspaceID, sessionID)
+    if err != nil {
+      fmt.Fprintln(os.Stderr, "warning: cgroup setup failed:", err)
+    } else {
+      applyCgroupLimits(cg, cgroupMemoryMax, cgroupPidsMax, cgroupCPUMax, cgroupIOMax)
+      cgDirFD, err = cg.OpenDirFD()
+      if err != nil {
+        fmt.Fprintln(os.Stderr, "warning: cgroup open failed:", err)
+      } else {
+        cmd.SysProcAttr.UseCgroupFD = true
+        cmd.SysProcAttr.CgroupFD = int(cgDirFD.Fd())
+      }
+    }
   }
-  if err := applyLandlock(allowRO, allowRW, allowROFiles, allowRWFiles, netMode); err != nil {
-    fail("landlock failed: " + err.Error())
+
+  startedAt := time.Now()
+  runErr := cmd.Start()
+  if cgDirFD != nil {
+    cgDirFD.Close()
   }
-  if err := applySeccomp(seccompMode, netMode); err != nil {
-    fail("seccomp failed")
+  secret.Wipe(secretPairs)
+  childSock.Close()
+  if ttySess != nil {
+    ttySess.closeSlave()
+    if runErr == nil {
+      ttySess.relay()
+    }
   }
 
-  if err := cmd.Run(); err != nil {
-    if exitErr := (*exec.ExitError)(nil); errors.As(err, &exitErr) {
+  // Prestart hooks run here, in this still-fully-privileged parent, with
+  // the real pid of the just-started trampoline process — strictly before
+  // that process is handed its sandboxing instructions and execs into the
+  // workspace command, matching the OCI contract's "before the container
+  // process starts" guarantee. A failure here is funneled into runErr
+  // rather than handled with an early fail() call, so it still reaches the
+  // single cleanup/exit path below (wiping secrets, removing the cgroup,
+  // restoring the tty, writing a session record) instead of skipping it.
+  if runErr == nil && hooks != nil && len(hooks.Prestart) > 0 {
+    if err := runHooks(hooks.Prestart, cmd.Process.Pid); err != nil {
+      fmt.Fprintln(os.Stderr, "prestart hook failed:", err)
+      _ = cmd.Process.Kill()
+      runErr = fmt.Errorf("prestart hook failed: %w", err)
+    }
+  }
+  prestartFailed := runErr != nil
+
+  if !prestartFailed {
+    if err := sendStage2Request(parentSock, stage2Request{
+      Command:          resolved,
+      Args:             commandArgs,
+      HomeDir:          homeDir,
+      WorkspaceRootDir: workspaceRootDir,
+      AllowRO:          allowRO,
+      AllowRW:          allowRW,
+      AllowROFiles:     allowROFiles,
+      AllowRWFiles:     allowRWFiles,
+      TmpDir:           tmpDir,
+      NetMode:          netMode,
+      SeccompProfile:   resolvedSeccompProfile,
+      NoSandbox:        noSandbox,
+      CapAdd:           keepCaps,
+      Overlay:          overlayFlag != "",
+      OverlaySpec:      overlaySpec,
+      UID:              uid,
+      GID:              gid,
+    }); err != nil {
+      // The real outcome still comes from cmd.Wait() below (stage2 exits 1
+      // on its own if sandboxing failed); this is just visibility into why.
+      fmt.Fprintln(os.Stderr, "warning: stage2 handshake:", err)
+    }
+  }
+  parentSock.Close()
+
+  if !prestartFailed {
+    runErr = cmd.Wait()
+  } else if cmd.Process != nil {
+    // The process was already killed above after its prestart hook failed;
+    // still reap it so cmd.ProcessState is populated for the session
+    // record below, without overwriting the prestart error as runErr.
+    _ = cmd.Wait()
+  }
+  endedAt := time.Now()
+
+  if secretsDir != "" {
+    // The command has exited (or never started), so the materialized
+    // secret files have served their purpose; nothing else should be able
+    // to find them sitting in cleartext under the session tree afterward.
+    if err := os.RemoveAll(secretsDir); err != nil {
+      fmt.Fprintln(os.Stderr, "warning: failed to remove secrets dir:", err)
+    }
+  }
+
+  oomKilled := false
+  if cg != nil {
+    oomKilled, _ = cg.OOMKilled()
+    if err := cg.Remove(); err != nil {
+      fmt.Fprintln(os.Stderr, "warning: cgroup cleanup failed:", err)
+    }
+  }
+
+  exitCode := 0
+  isExitError := false
+  if runErr != nil {
+    exitCode = 1
+    if exitErr := (*exec.ExitError)(nil); errors.As(runErr, &exitErr) {
+      isExitError = true
       if status, ok := exitErr.Sys().(syscall.WaitStatus); ok {
-        os.Exit(status.ExitStatus())
+        exitCode = status.ExitStatus()
       }
     }
+  }
+  if oomKilled {
+    exitCode = oomExitCode
+  }
+
+  if hooks != nil && len(hooks.Poststop) > 0 && cmd.Process != nil {
+    if err := runHooks(hooks.Poststop, cmd.Process.Pid); err != nil {
+      // The workspace command already ran to completion; a poststop hook
+      // failing is worth surfacing but shouldn't mask its exit code.
+      fmt.Fprintln(os.Stderr, "warning: poststop hook failed:", err)
+    }
+  }
+
+  if _, err := session.Write(sessionsDir, sessionID, uid, gid, session.Record{
+    StartedAt: startedAt,
+    EndedAt:   endedAt,
+    Command:   resolved,
+    Args:      commandArgs,
+    Env:       env,
+    Cwd:       cwdForRecord,
+    ExitCode:  exitCode,
+    Rusage:    session.RusageFromProcessState(cmd.ProcessState),
+  }); err != nil {
+    fmt.Fprintln(os.Stderr, "warning: failed to write session journal:", err)
+  }
+
+  // Every path out of main funnels through here so this cleanup always
+  // runs, since os.Exit below (and fail's own os.Exit) skip deferred
+  // functions entirely.
+  signal.Stop(sigCh)
+  if ttySess != nil {
+    ttySess.Close()
+  }
+  if safeCwd != nil {
+    safeCwd.Close()
+  }
+
+  if runErr != nil && !isExitError {
     fail("command failed")
   }
+  os.Exit(exitCode)
+}
+
+// readSecrets loads the framed KEY=VALUE stream from --secret-fd (an
+// inherited descriptor) or --secret-file, preferring the fd when both are
+// somehow set.
+func readSecrets(secretFD int, secretFile string) ([]secret.Pair, error) {
+  if secretFD >= 0 {
+    f := os.NewFile(uintptr(secretFD), "secret-fd")
+    if f == nil {
+      return nil, fmt.Errorf("invalid secret-fd %d", secretFD)
+    }
+    defer f.Close()
+    return secret.ReadFramed(f)
+  }
+  f, err := os.Open(secretFile)
+  if err != nil {
+    return nil, fmt.Errorf("open secret-file: %w", err)
+  }
+  defer f.Close()
+  return secret.ReadFramed(f)
 }
 
 func resolveCommand(command string) (string, error) {
@@ -269,18 +664,8 @@ func resolveCommand(command string) (string, error) {
 }
 
 func lookupIDs(workspaceID string) (uint32, uint32, error) {
-  uidRaw, uidErr := exec.Command("id", "-u", workspaceID).Output()
-  gidRaw, gidErr := exec.Command("id", "-g", workspaceID).Output()
-  if uidErr == nil && gidErr == nil {
-    uid, err := parseUint(strings.TrimSpace(string(uidRaw)))
-    if err != nil {
-      return 0, 0, errors.New("invalid uid")
-    }
-    gid, err := parseUint(strings.TrimSpace(string(gidRaw)))
-    if err != nil {
-      return 0, 0, errors.New("invalid gid")
-    }
-    return uid, gid, nil
+  if user, err := userdb.LookupUser(workspaceID); err == nil {
+    return uint32(user.UID), uint32(user.GID), nil
   }
 
   uid, gid, err := readIDsFromConfig(workspaceID)
@@ -288,23 +673,9 @@ func lookupIDs(workspaceID string) (uint32, uint32, error) {
     return uid, gid, nil
   }
 
-  if uidErr != nil {
-    return 0, 0, errors.New("unable to resolve uid")
-  }
-  if gidErr != nil {
-    return 0, 0, errors.New("unable to resolve gid")
-  }
   return 0, 0, errors.New("unable to resolve workspace ids")
 }
 
-func parseUint(value string) (uint32, error) {
-  parsed, err := strconv.ParseUint(value, 10, 32)
-  if err != nil {
-    return 0, err
-  }
-  return uint32(parsed), nil
-}
-
 type workspaceConfig struct {
   UID int `json:"uid"`
   GID int `json:"gid"`
@@ -422,44 +793,42 @@ func ensureBaseReadPaths(paths []string, resolvedCommand string) []string {
   return uniqueStrings(append(paths, base...))
 }
 
-func applyLandlock(allowRO, allowRW, allowROFiles, allowRWFiles []string, netMode string) error {
-  if len(allowRO) == 0 && len(allowRW) == 0 && len(allowROFiles) == 0 && len(allowRWFiles) == 0 && netMode == "" {
-    return nil
-  }
+// applyLandlock confines the process (and everything exec'd after this
+// point) to the workspace plus whatever caller-specified paths were passed
+// via --allow-ro/--allow-rw/etc. The baseline system-read + workspace-write
+// rules in sandbox.Apply are always enforced regardless of those flags.
+func applyLandlock(homeDir, workspaceRootDir, tmpDir string, allowRO, allowRW, allowROFiles, allowRWFiles []string, netMode string) error {
   if err := ensureDirsExist(allowRO, "allow-ro"); err != nil {
     return err
   }
   if err := ensureDirsExist(allowRW, "allow-rw"); err != nil {
     return err
   }
+  if err := ensureDirsExist([]string{tmpDir}, "tmpdir"); err != nil {
+    return err
+  }
   if err := validatePathsExist(allowROFiles, "allow-ro-file"); err != nil {
     return err
   }
   if err := validatePathsExist(allowRWFiles, "allow-rw-file"); err != nil {
     return err
   }
-  ruleset := landlock.V6.BestEffort()
-  if len(allowRO) > 0 || len(allowRW) > 0 || len(allowROFiles) > 0 || len(allowRWFiles) > 0 {
-    if err := ruleset.RestrictPaths(
-      landlock.RODirs(allowRO...),
-      landlock.RWDirs(allowRW...),
-      landlock.ROFiles(allowROFiles...),
-      landlock.RWFiles(allowRWFiles...),
-    ); err != nil {
-      return err
-    }
-  }
-  if netMode == "" {
-    return nil
-  }
+
   netRules, err := buildNetRules(netMode)
   if err != nil {
     return err
   }
-  if err := ruleset.RestrictNet(netRules...); err != nil {
-    return err
-  }
-  return nil
+
+  return sandbox.Apply(sandbox.Config{
+    HomeDir: homeDir,
+    WorkspaceRootDir: workspaceRootDir,
+    TmpDir: tmpDir,
+    ExtraRO: allowRO,
+    ExtraRW: allowRW,
+    ExtraROFiles: allowROFiles,
+    ExtraRWFiles: allowRWFiles,
+    NetRules: netRules,
+  })
 }
 
 func buildNetRules(netMode string) ([]landlock.Rule, error) {
@@ -513,52 +882,30 @@ func parsePorts(raw string) ([]int, error) {
   return result, nil
 }
 
-func applySeccomp(mode string, netMode string) error {
-  if mode == "" || mode == "off" {
-    return nil
-  }
-  filter, err := seccomp.NewFilter(seccomp.ActAllow)
-  if err != nil {
-    return err
+// applyCgroupLimits writes whichever of the four --cgroup-*-max values were
+// set. A single limit failing to apply is logged and otherwise ignored
+// rather than aborting the invocation, matching how cgroup setup/join
+// failures are handled around the call site.
+func applyCgroupLimits(cg *cgroup.Cgroup, memoryMax, pidsMax, cpuMax, ioMax string) {
+  if memoryMax != "" {
+    if err := cg.SetMemoryMax(memoryMax); err != nil {
+      fmt.Fprintln(os.Stderr, "warning: cgroup memory.max failed:", err)
+    }
   }
-  if netMode == "none" {
-    if err := blockNetworkSyscalls(filter); err != nil {
-      return err
+  if pidsMax != "" {
+    if err := cg.SetPidsMax(pidsMax); err != nil {
+      fmt.Fprintln(os.Stderr, "warning: cgroup pids.max failed:", err)
     }
   }
-  return filter.Load()
-}
-
-func blockNetworkSyscalls(filter *seccomp.ScmpFilter) error {
-  blocked := []string{
-    "socket",
-    "socketpair",
-    "connect",
-    "accept",
-    "accept4",
-    "bind",
-    "listen",
-    "sendto",
-    "sendmsg",
-    "sendmmsg",
-    "recvfrom",
-    "recvmsg",
-    "recvmmsg",
-    "shutdown",
-    "getsockopt",
-    "setsockopt",
-    "getpeername",
-    "getsockname",
-  }
-  action := seccomp.ActErrno.SetReturnCode(int16(syscall.EPERM))
-  for _, name := range blocked {
-    syscallID, err := seccomp.GetSyscallFromName(name)
-    if err != nil {
-      continue
+  if cpuMax != "" {
+    if err := cg.SetCPUMax(cpuMax); err != nil {
+      fmt.Fprintln(os.Stderr, "warning: cgroup cpu.max failed:", err)
     }
-    if err := filter.AddRule(syscallID, action); err != nil {
-      return err
+  }
+  if ioMax != "" {
+    if err := cg.SetIOMax(ioMax); err != nil {
+      fmt.Fprintln(os.Stderr, "warning: cgroup io.max failed:", err)
     }
   }
-  return nil
 }
+
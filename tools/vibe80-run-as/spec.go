@@ -0,0 +1,100 @@
+package main
+
+import (
+  "strconv"
+  "strings"
+
+  "vibe80/vibe80/internal/launchspec"
+)
+
+// mergeSpec fills in any flag that wasn't set on the command line from the
+// corresponding field of spec, so a --spec document works as a full
+// replacement for the flags it covers while any flag an operator does pass
+// still wins outright. The four --allow-* flags count as one group here:
+// spec.Mounts is used only when none of them was passed.
+func mergeSpec(spec *launchspec.Spec, workspaceID, cwd, command *string, commandArgs *[]string, envPairs *[]string,
+  allowRO, allowRW, allowROFiles, allowRWFiles *[]string,
+  netMode, seccompProfile, capAdd *string, ttyFlag *bool,
+  cgroupMemoryMax, cgroupPidsMax, cgroupCPUMax, cgroupIOMax *string) {
+
+  if *workspaceID == "" {
+    *workspaceID = spec.WorkspaceID
+  }
+  if *cwd == "" {
+    *cwd = spec.Cwd
+  }
+  if *command == "" && spec.Command != nil {
+    *command = spec.Command.Path
+    *commandArgs = spec.Command.Args
+  }
+  if len(*envPairs) == 0 {
+    for key, value := range spec.Env {
+      *envPairs = append(*envPairs, key+"="+value)
+    }
+  }
+  if len(*allowRO) == 0 && len(*allowRW) == 0 && len(*allowROFiles) == 0 && len(*allowRWFiles) == 0 {
+    for _, mount := range spec.Mounts {
+      switch {
+      case mount.Kind == "dir" && mount.Mode == "ro":
+        *allowRO = append(*allowRO, mount.Path)
+      case mount.Kind == "dir" && mount.Mode == "rw":
+        *allowRW = append(*allowRW, mount.Path)
+      case mount.Kind == "file" && mount.Mode == "ro":
+        *allowROFiles = append(*allowROFiles, mount.Path)
+      case mount.Kind == "file" && mount.Mode == "rw":
+        *allowRWFiles = append(*allowRWFiles, mount.Path)
+      default:
+        fail("launchspec: invalid mount mode/kind: " + mount.Mode + "/" + mount.Kind)
+      }
+    }
+  }
+  if *netMode == "" && spec.Network != nil {
+    *netMode = netModeFromSpec(spec.Network)
+  }
+  if *seccompProfile == "" && spec.Seccomp != nil {
+    *seccompProfile = spec.Seccomp.ProfilePath
+  }
+  if *capAdd == "" && spec.Capabilities != nil {
+    keep := append(append([]string{}, spec.Capabilities.Bounding...), spec.Capabilities.Effective...)
+    *capAdd = strings.Join(uniqueStrings(keep), ",")
+  }
+  if spec.TTY {
+    *ttyFlag = true
+  }
+  if spec.Cgroups != nil {
+    if *cgroupMemoryMax == "" {
+      *cgroupMemoryMax = spec.Cgroups.MemoryMax
+    }
+    if *cgroupPidsMax == "" {
+      *cgroupPidsMax = spec.Cgroups.PidsMax
+    }
+    if *cgroupCPUMax == "" {
+      *cgroupCPUMax = spec.Cgroups.CPUMax
+    }
+    if *cgroupIOMax == "" {
+      *cgroupIOMax = spec.Cgroups.IOMax
+    }
+  }
+}
+
+func netModeFromSpec(network *launchspec.Network) string {
+  switch network.Mode {
+  case "", "none":
+    return "none"
+  case "tcp":
+    return "tcp:" + joinPorts(network.Ports)
+  case "bind":
+    return "bind:" + joinPorts(network.Ports)
+  default:
+    fail("launchspec: invalid network mode: " + network.Mode)
+    return ""
+  }
+}
+
+func joinPorts(ports []int) string {
+  parts := make([]string, len(ports))
+  for i, port := range ports {
+    parts[i] = strconv.Itoa(port)
+  }
+  return strings.Join(parts, ",")
+}
@@ -0,0 +1,163 @@
+package main
+
+import (
+  "bufio"
+  "encoding/json"
+  "fmt"
+  "os"
+  "strings"
+  "syscall"
+
+  "golang.org/x/sys/unix"
+
+  "vibe80/vibe80/internal/caps"
+  "vibe80/vibe80/internal/overlay"
+)
+
+// stage2Flag re-execs this same binary as the trampoline's child half (see
+// runStage2); it's deliberately not a flag handled by the normal arg loop
+// in main, since stage2 invocations never come from an operator.
+const stage2Flag = "--stage2"
+
+// stage2CtrlFD is where the parent always places the control socket: the
+// first (and only) entry in cmd.ExtraFiles, which Go places right after the
+// inherited stdin/stdout/stderr.
+const stage2CtrlFD = 3
+
+// stage2Request is everything the stage2 child needs to sandbox itself
+// before it execve's the resolved command, sent once over the control
+// socket after the parent's cmd.Start() returns and any prestart hooks
+// have run.
+type stage2Request struct {
+  Command          string    `json:"command"`
+  Args             []string  `json:"args"`
+  HomeDir          string    `json:"home_dir"`
+  WorkspaceRootDir string    `json:"workspace_root_dir"`
+  AllowRO          []string  `json:"allow_ro"`
+  AllowRW          []string  `json:"allow_rw"`
+  AllowROFiles     []string  `json:"allow_ro_files"`
+  AllowRWFiles     []string  `json:"allow_rw_files"`
+  TmpDir           string    `json:"tmp_dir"`
+  NetMode          string    `json:"net_mode"`
+  SeccompProfile   string    `json:"seccomp_profile"`
+  NoSandbox        bool      `json:"no_sandbox"`
+  CapAdd           []uintptr `json:"cap_add"`
+  Overlay          bool         `json:"overlay"`
+  OverlaySpec      overlay.Spec `json:"overlay_spec"`
+  UID              uint32       `json:"uid"`
+  GID              uint32       `json:"gid"`
+}
+
+// socketpair opens a connected pair of unix sockets for the stage2 control
+// channel: one end stays with the parent, the other is handed to the child
+// via cmd.ExtraFiles.
+func socketpair() (*os.File, *os.File, error) {
+  fds, err := unix.Socketpair(unix.AF_UNIX, unix.SOCK_STREAM, 0)
+  if err != nil {
+    return nil, nil, fmt.Errorf("socketpair: %w", err)
+  }
+  return os.NewFile(uintptr(fds[0]), "stage2-parent"), os.NewFile(uintptr(fds[1]), "stage2-child"), nil
+}
+
+// sendStage2Request writes req to the parent's end of the control socket
+// and blocks for the child's one-line ack, confirming sandboxing was
+// applied before the parent moves on to waiting for the child.
+func sendStage2Request(parentSock *os.File, req stage2Request) error {
+  if err := json.NewEncoder(parentSock).Encode(req); err != nil {
+    return fmt.Errorf("encode stage2 request: %w", err)
+  }
+  line, err := bufio.NewReader(parentSock).ReadString('\n')
+  if err != nil {
+    return fmt.Errorf("read stage2 ack: %w", err)
+  }
+  if strings.TrimSpace(line) != "ok" {
+    return fmt.Errorf("stage2 ack: %s", strings.TrimSpace(line))
+  }
+  return nil
+}
+
+// runStage2 is the child half of the re-exec trampoline (runc's nsexec
+// pattern). It starts out with the parent's full root privileges — nothing
+// upstream of it has dropped uid, gid, or capabilities yet — and works
+// through sandboxing in the order each step needs whatever privilege the
+// prior steps haven't stripped yet: the overlay mount (needs CAP_SYS_ADMIN,
+// which isn't in any workspace's --cap-add allowlist and so wouldn't
+// survive caps.DropAll), then caps.DropAll (prunes the bounding set and
+// narrows down to the operator's --cap-add list plus CAP_SETUID/
+// CAP_SETGID), then landlock, then the uid/gid switch itself (needs the
+// CAP_SETUID/CAP_SETGID caps.DropAll deliberately left in place), then
+// caps.FinishDropAll (drops those two for good), then seccomp — tightest
+// last, since seccomp can't be loosened again afterward. It acks readiness
+// and execve's the resolved command; it never returns normally: either the
+// exec replaces this process image, or it exits 1.
+func runStage2() {
+  ctrl := os.NewFile(stage2CtrlFD, "stage2-ctrl")
+
+  var req stage2Request
+  if err := json.NewDecoder(ctrl).Decode(&req); err != nil {
+    fmt.Fprintln(os.Stderr, "stage2: decode request:", err)
+    os.Exit(1)
+  }
+
+  if req.Overlay {
+    if err := overlay.Mount(req.WorkspaceRootDir, req.OverlaySpec); err != nil {
+      stage2Fail(ctrl, fmt.Errorf("overlay failed: %w", err))
+    }
+  }
+
+  if err := caps.DropAll(req.CapAdd); err != nil {
+    stage2Fail(ctrl, err)
+  }
+
+  if req.NoSandbox {
+    fmt.Fprintln(os.Stderr, "warning: landlock sandbox disabled via --no-sandbox")
+  } else if err := applyLandlock(req.HomeDir, req.WorkspaceRootDir, req.TmpDir, req.AllowRO, req.AllowRW, req.AllowROFiles, req.AllowRWFiles, req.NetMode); err != nil {
+    stage2Fail(ctrl, fmt.Errorf("landlock failed: %w", err))
+  }
+
+  if err := switchToWorkspaceUser(req.UID, req.GID); err != nil {
+    stage2Fail(ctrl, fmt.Errorf("uid/gid switch failed: %w", err))
+  }
+  if err := caps.FinishDropAll(req.CapAdd); err != nil {
+    stage2Fail(ctrl, err)
+  }
+
+  if err := applySeccompProfile(req.SeccompProfile); err != nil {
+    stage2Fail(ctrl, fmt.Errorf("seccomp failed: %w", err))
+  }
+
+  if _, err := ctrl.Write([]byte("ok\n")); err != nil {
+    os.Exit(1)
+  }
+  ctrl.Close()
+
+  if err := syscall.Exec(req.Command, append([]string{req.Command}, req.Args...), os.Environ()); err != nil {
+    fmt.Fprintln(os.Stderr, "stage2: exec failed:", err)
+    os.Exit(1)
+  }
+}
+
+// switchToWorkspaceUser drops this process from root to the workspace's
+// uid/gid. It has to run inside stage2 — after caps.DropAll has pruned the
+// bounding set but before caps.FinishDropAll drops CAP_SETUID/CAP_SETGID —
+// rather than via the parent's cmd.SysProcAttr.Credential, since a
+// Credential switch happens at fork/exec time and would strip root (and
+// the capabilities above) before any of this file's code ever ran.
+func switchToWorkspaceUser(uid, gid uint32) error {
+  if err := unix.Setgroups([]int{int(gid)}); err != nil {
+    return fmt.Errorf("setgroups: %w", err)
+  }
+  if err := unix.Setresgid(int(gid), int(gid), int(gid)); err != nil {
+    return fmt.Errorf("setresgid: %w", err)
+  }
+  if err := unix.Setresuid(int(uid), int(uid), int(uid)); err != nil {
+    return fmt.Errorf("setresuid: %w", err)
+  }
+  return nil
+}
+
+func stage2Fail(ctrl *os.File, err error) {
+  fmt.Fprintln(os.Stderr, "stage2:", err)
+  ctrl.Close()
+  os.Exit(1)
+}
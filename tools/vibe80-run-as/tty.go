@@ -0,0 +1,82 @@
+package main
+
+import (
+  "fmt"
+  "io"
+  "os"
+  "os/exec"
+  "os/signal"
+  "syscall"
+
+  "github.com/creack/pty"
+  "golang.org/x/term"
+)
+
+// ttySession is the parent-side half of an interactive invocation: the pty
+// master plus enough state to restore the real terminal once the child
+// exits.
+type ttySession struct {
+  ptmx     *os.File
+  slave    *os.File
+  oldState *term.State
+}
+
+// setupTTY allocates a pty pair, wires cmd's stdio to the slave end, and
+// puts the operator's real stdin into raw mode so the child sees exactly
+// the bytes typed (no local line editing or echo in the way). The caller is
+// responsible for calling closeSlave once the child has started and Close
+// once it has exited.
+func setupTTY(cmd *exec.Cmd) (*ttySession, error) {
+  ptmx, slave, err := pty.Open()
+  if err != nil {
+    return nil, fmt.Errorf("open pty: %w", err)
+  }
+
+  if size, err := pty.GetsizeFull(os.Stdin); err == nil {
+    _ = pty.Setsize(ptmx, size)
+  }
+
+  oldState, err := term.MakeRaw(int(os.Stdin.Fd()))
+  if err != nil {
+    ptmx.Close()
+    slave.Close()
+    return nil, fmt.Errorf("make raw: %w", err)
+  }
+
+  cmd.Stdin = slave
+  cmd.Stdout = slave
+  cmd.Stderr = slave
+
+  return &ttySession{ptmx: ptmx, slave: slave, oldState: oldState}, nil
+}
+
+// closeSlave releases the parent's copy of the slave fd once the child has
+// its own (duplicated at Start), so the master's read side actually sees
+// EOF once the child's side closes rather than the parent's lingering copy
+// keeping it open.
+func (s *ttySession) closeSlave() {
+  s.slave.Close()
+}
+
+// relay copies between the pty master and the operator's real stdin/stdout,
+// and forwards SIGWINCH as pty resizes, for as long as the child is alive.
+func (s *ttySession) relay() {
+  go io.Copy(s.ptmx, os.Stdin)
+  go io.Copy(os.Stdout, s.ptmx)
+
+  winch := make(chan os.Signal, 1)
+  signal.Notify(winch, syscall.SIGWINCH)
+  go func() {
+    for range winch {
+      if size, err := pty.GetsizeFull(os.Stdin); err == nil {
+        _ = pty.Setsize(s.ptmx, size)
+      }
+    }
+  }()
+}
+
+// Close restores the real terminal's mode and releases the pty master.
+func (s *ttySession) Close() {
+  term.Restore(int(os.Stdin.Fd()), s.oldState)
+  s.ptmx.Close()
+}
@@ -8,9 +8,10 @@ import (
   "os/exec"
   "path/filepath"
   "regexp"
-  "strconv"
   "strings"
   "syscall"
+
+  "vibe80/vibe80/internal/userdb"
 )
 
 var workspaceIDPattern = regexp.MustCompile(`^w[0-9a-f]{24}$`)
@@ -178,18 +179,8 @@ func resolveCommand(command string) (string, error) {
 }
 
 func lookupIDs(workspaceID string) (uint32, uint32, error) {
-  uidRaw, uidErr := exec.Command("id", "-u", workspaceID).Output()
-  gidRaw, gidErr := exec.Command("id", "-g", workspaceID).Output()
-  if uidErr == nil && gidErr == nil {
-    uid, err := parseUint(strings.TrimSpace(string(uidRaw)))
-    if err != nil {
-      return 0, 0, errors.New("invalid uid")
-    }
-    gid, err := parseUint(strings.TrimSpace(string(gidRaw)))
-    if err != nil {
-      return 0, 0, errors.New("invalid gid")
-    }
-    return uid, gid, nil
+  if user, err := userdb.LookupUser(workspaceID); err == nil {
+    return uint32(user.UID), uint32(user.GID), nil
   }
 
   uid, gid, err := readIDsFromConfig(workspaceID)
@@ -197,23 +188,9 @@ func lookupIDs(workspaceID string) (uint32, uint32, error) {
     return uid, gid, nil
   }
 
-  if uidErr != nil {
-    return 0, 0, errors.New("unable to resolve uid")
-  }
-  if gidErr != nil {
-    return 0, 0, errors.New("unable to resolve gid")
-  }
   return 0, 0, errors.New("unable to resolve workspace ids")
 }
 
-func parseUint(value string) (uint32, error) {
-  parsed, err := strconv.ParseUint(value, 10, 32)
-  if err != nil {
-    return 0, err
-  }
-  return uint32(parsed), nil
-}
-
 type workspaceConfig struct {
   UID int `json:"uid"`
   GID int `json:"gid"`